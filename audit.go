@@ -0,0 +1,157 @@
+package main
+
+import (
+    "bufio"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    "time"
+)
+
+// A release action, stored as one JSON line in the append-only audit log.
+type auditEntry struct {
+    User string `json:"user"`
+    Command string `json:"command"`
+    App string `json:"app,omitempty"`
+    Version string `json:"version,omitempty"`
+    VersionCode int64 `json:"versionCode,omitempty"`
+    Track string `json:"track,omitempty"`
+    UserFraction float64 `json:"userFraction,omitempty"`
+    EditId string `json:"editId,omitempty"`
+    DryRun bool `json:"dryRun,omitempty"`
+    Outcome string `json:"outcome"`
+    Started time.Time `json:"started"`
+    Finished time.Time `json:"finished"`
+}
+
+// The most entries 'history' shows, so the message stays readable.
+const maxListedAuditEntries = 100
+
+var auditMutex sync.Mutex
+
+func appendAuditEntry(entry *auditEntry) error {
+    data, err := json.Marshal(entry)
+
+    if err != nil {
+        return err
+    }
+
+    auditMutex.Lock()
+    defer auditMutex.Unlock()
+
+    file, err := os.OpenFile(getAuditFileName(), os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0644)
+
+    if err != nil {
+        return err
+    }
+
+    _, err = file.Write(append(data, '\n'))
+
+    if err != nil {
+        file.Close()
+        return err
+    }
+
+    return file.Close()
+}
+
+func getAuditFileName() string {
+    return getOptionalConfig("AUDIT_LOG_FILE", "audit.log")
+}
+
+func loadAuditEntries() ([]*auditEntry, error) {
+    auditMutex.Lock()
+    defer auditMutex.Unlock()
+
+    file, err := os.Open(getAuditFileName())
+
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+
+    if err != nil {
+        return nil, err
+    }
+
+    defer file.Close()
+
+    var result []*auditEntry
+
+    scanner := bufio.NewScanner(file)
+
+    for scanner.Scan() {
+        entry := &auditEntry {}
+
+        err = json.Unmarshal(scanner.Bytes(), entry)
+
+        if err != nil {
+            return nil, err
+        }
+
+        result = append(result, entry)
+    }
+
+    return result, scanner.Err()
+}
+
+func writeAuditEntriesAsCsv(writer io.Writer, entries []*auditEntry) error {
+    csvWriter := csv.NewWriter(writer)
+
+    err := csvWriter.Write([]string {
+        "started",
+        "finished",
+        "user",
+        "command",
+        "app",
+        "version",
+        "versionCode",
+        "track",
+        "userFraction",
+        "editId",
+        "dryRun",
+        "outcome",
+    })
+
+    if err != nil {
+        return err
+    }
+
+    for _, entry := range entries {
+        err = csvWriter.Write([]string {
+            entry.Started.Format(time.RFC3339),
+            entry.Finished.Format(time.RFC3339),
+            entry.User,
+            entry.Command,
+            entry.App,
+            entry.Version,
+            fmt.Sprint(entry.VersionCode),
+            entry.Track,
+            fmt.Sprint(entry.UserFraction),
+            entry.EditId,
+            fmt.Sprint(entry.DryRun),
+            entry.Outcome,
+        })
+
+        if err != nil {
+            return err
+        }
+    }
+
+    csvWriter.Flush()
+
+    return csvWriter.Error()
+}
+
+func writeAuditEntriesAsJson(writer io.Writer, entries []*auditEntry) error {
+    encoder := json.NewEncoder(writer)
+    encoder.SetIndent("", "  ")
+
+    if entries == nil {
+        entries = []*auditEntry {}
+    }
+
+    return encoder.Encode(entries)
+}
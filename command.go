@@ -0,0 +1,794 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "github.com/nlopes/slack"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type command struct {
+    name string
+    grammar string
+    description string
+    examples []string
+    immediate bool
+    mutating bool
+    permission commandPermission
+    handler func(ctx context.Context, arguments *commandArguments) bool
+    expression *regexp.Regexp
+    parameters []*commandParameter
+}
+
+type commandArguments struct {
+    app string
+    command string
+    dryRun bool
+    fileName string
+    fileUrl string
+    format string
+    interval time.Duration
+    jobId int
+    language string
+    limit int
+    scheduleId int
+    storeTrack string
+    text string
+    user string
+    userPercentage int
+    userPercentages []int
+    version string
+    versionCode int64
+}
+
+type commandParameter struct {
+    name string
+    description string
+    expression string
+    parse func(value string, arguments *commandArguments) bool
+}
+
+type commandPermission int
+
+const (
+    permissionEveryone commandPermission = iota
+    permissionGod
+    permissionGodUnlessTestTrack
+)
+
+var commandParameters = map[string]*commandParameter {
+    "app": {
+        name: "app",
+        description: "The Maven artifact ID, which is also the last part of the application ID.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            arguments.app = value
+            return true
+        },
+    },
+    "command": {
+        name: "command",
+        description: "The name of a command, e.g. _promote_ or _show tracks_.",
+        expression: ".+",
+        parse: func(value string, arguments *commandArguments) bool {
+            arguments.command = value
+            return true
+        },
+    },
+    "format": {
+        name: "format",
+        description: "The file format, either _csv_ or _json_.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            arguments.format = strings.ToLower(value)
+            return arguments.format == "csv" || arguments.format == "json"
+        },
+    },
+    "interval": {
+        name: "interval",
+        description: "The time between two steps, e.g. _24h_ or _90m_.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            interval, err := time.ParseDuration(value)
+            arguments.interval = interval
+            return err == nil && interval >= time.Minute
+        },
+    },
+    "job": {
+        name: "job",
+        description: "The number of a job, as announced when it was started.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            jobId, err := strconv.Atoi(strings.TrimPrefix(value, "#"))
+            arguments.jobId = jobId
+            return err == nil
+        },
+    },
+    "language": {
+        name: "language",
+        description: "The Play Store language code of the release notes, e.g. _en-US_ or _de-DE_.",
+        expression: "[^ :]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            arguments.language = value
+            return true
+        },
+    },
+    "limit": {
+        name: "limit",
+        description: "The maximum number of entries to show.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            limit, err := strconv.Atoi(value)
+            arguments.limit = limit
+            return err == nil && limit > 0
+        },
+    },
+    "percentage": {
+        name: "user percentage",
+        description: "The percentage of users that get the version, from 1 to 100.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            userPercentage, err := strconv.Atoi(value)
+            arguments.userPercentage = userPercentage
+            return err == nil && userPercentage > 0 && userPercentage <= 100
+        },
+    },
+    "text": {
+        name: "text",
+        description: "The release notes, up to 500 characters.",
+        expression: ".+",
+        parse: func(value string, arguments *commandArguments) bool {
+            arguments.text = strings.TrimSpace(unescapeSlackText(value))
+            return len(arguments.text) > 0
+        },
+    },
+    "percentages": {
+        name: "user percentages",
+        description: "The increasing percentages of users for the steps, separated by commas, e.g. _1,5,20,50,100_.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            arguments.userPercentages = nil
+
+            for _, field := range strings.Split(value, ",") {
+                userPercentage, err := strconv.Atoi(strings.TrimSuffix(field, "%"))
+
+                if err != nil || userPercentage <= 0 || userPercentage > 100 {
+                    return false
+                }
+
+                count := len(arguments.userPercentages)
+
+                if count > 0 && arguments.userPercentages[count - 1] >= userPercentage {
+                    return false
+                }
+
+                arguments.userPercentages = append(arguments.userPercentages, userPercentage)
+            }
+
+            return true
+        },
+    },
+    "schedule": {
+        name: "schedule",
+        description: "The number of a schedule, as shown by _show schedules_.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            scheduleId, err := strconv.Atoi(strings.TrimPrefix(value, "#"))
+            arguments.scheduleId = scheduleId
+            return err == nil
+        },
+    },
+    "track": {
+        name: "track",
+        description: "The Play Store track, e.g. _internal_, _alpha_, _beta_ or _production_.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            arguments.storeTrack = value
+            return true
+        },
+    },
+    "version": {
+        name: "version",
+        description: "The Maven version of the artifact, or _latest_, _release_ or a SNAPSHOT version for its newest build.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            arguments.version = value
+            return true
+        },
+    },
+    "versionCode": {
+        name: "version code",
+        description: "The Android version code, as shown by _show tracks_.",
+        expression: "[^ ]+",
+        parse: func(value string, arguments *commandArguments) bool {
+            versionCode, err := strconv.ParseInt(value, 10, 64)
+            arguments.versionCode = versionCode
+            return err == nil
+        },
+    },
+}
+
+var commandDryRunPrefixExpression = regexp.MustCompile("^(<[^>]+>) +plan +")
+
+var commandDryRunSuffixExpression = regexp.MustCompile(" +(--|—)dry-run *$")
+
+var commandMentionExpression = regexp.MustCompile("^<[^>]+> +")
+
+var commandPlaceholderExpression = regexp.MustCompile("<([A-Za-z]+)>")
+
+var commands []*command
+
+func init() {
+    commands = []*command {
+        {
+            name: "cancel",
+            grammar: "cancel <job>",
+            description: "Cancels a queued or running job and abandons its edit.",
+            examples: []string {"cancel 42"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doCancel(arguments.jobId, arguments.user)
+            },
+        },
+        {
+            name: "cancel schedule",
+            grammar: "cancel schedule <schedule>",
+            description: "Stops a scheduled rollout before its next step.",
+            examples: []string {"cancel schedule 3"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doCancelSchedule(arguments.scheduleId, arguments.user)
+            },
+        },
+        {
+            name: "complete",
+            grammar: "complete <app> <versionCode>",
+            description: "Rolls the staged rollout of the version code out to all users and drops the release it supersedes. A halted rollout needs a _resume_ first.",
+            examples: []string {"complete myapp 1234"},
+            mutating: true,
+            permission: permissionGod,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doComplete(ctx, arguments.app, arguments.versionCode, arguments.dryRun)
+            },
+        },
+        {
+            name: "deploy",
+            grammar: "deploy <app> <version>",
+            description: "Uploads the Maven artifact with that version to the internal track, preferring an app bundle over an APK, with the release notes of its `release-notes` JSON or zip artifact.",
+            examples: []string {"deploy myapp 1.2.3", "deploy myapp 1.2.3 --dry-run"},
+            mutating: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doDeploy(ctx, arguments.app, arguments.version, arguments.dryRun)
+            },
+        },
+        {
+            name: "export history",
+            grammar: "export history as <format>",
+            description: "Uploads the whole audit log of release actions as a file.",
+            examples: []string {"export history as csv", "export history as json"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doExportHistory(arguments.format)
+            },
+        },
+        {
+            name: "halt",
+            grammar: "halt <app> <versionCode>",
+            description: "Halts the staged rollout of the version code, keeping its user percentage.",
+            examples: []string {"halt myapp 1234"},
+            mutating: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doHalt(ctx, arguments.app, arguments.versionCode, arguments.dryRun)
+            },
+        },
+        {
+            name: "help",
+            grammar: "help",
+            description: "Lists all commands.",
+            examples: []string {"help"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                doHelp("")
+                return true
+            },
+        },
+        {
+            name: "help",
+            grammar: "help <command>",
+            description: "Explains a command and its arguments.",
+            examples: []string {"help promote", "help show tracks"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                doHelp(arguments.command)
+                return true
+            },
+        },
+        {
+            name: "history",
+            grammar: "history for <app>",
+            description: "Shows the last release actions for the app.",
+            examples: []string {"history for myapp"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doHistory(arguments.app, 10)
+            },
+        },
+        {
+            name: "history",
+            grammar: "history for <app> <limit>",
+            description: fmt.Sprintf("Shows up to that many, at most %v, of the last release actions for the app.", maxListedAuditEntries),
+            examples: []string {"history for myapp 50"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doHistory(arguments.app, arguments.limit)
+            },
+        },
+        {
+            name: "jobs",
+            grammar: "jobs",
+            description: "Lists the queued, running and recently finished jobs.",
+            examples: []string {"jobs"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                doJobs()
+                return true
+            },
+        },
+        {
+            name: "list versions",
+            grammar: "list versions for <app>",
+            description: "Shows the newest Maven versions of the app and the tracks they are on, " +
+                    "by release name or by the deploys of the history.",
+            examples: []string {"list versions for myapp"},
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doListVersions(ctx, arguments.app, 10)
+            },
+        },
+        {
+            name: "list versions",
+            grammar: "list versions for <app> <limit>",
+            description: fmt.Sprintf(
+                    "Shows up to that many, at most %v, of the newest Maven versions of the app and the tracks they are on, " +
+                    "by release name or by the deploys of the history.",
+                    maxListedMavenVersions),
+            examples: []string {"list versions for myapp 20"},
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doListVersions(ctx, arguments.app, arguments.limit)
+            },
+        },
+        {
+            name: "ping",
+            grammar: "ping",
+            description: "Checks whether I'm listening.",
+            examples: []string {"ping"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                doPing()
+                return true
+            },
+        },
+        {
+            name: "promote",
+            grammar: "promote <app> <versionCode> to <track>",
+            description: "Moves the version code to the track and removes it from all other tracks.",
+            examples: []string {"promote myapp 1234 to beta", "plan promote myapp 1234 to production"},
+            mutating: true,
+            permission: permissionGodUnlessTestTrack,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doPromote(ctx, arguments.app, arguments.versionCode, arguments.storeTrack, arguments.dryRun)
+            },
+        },
+        {
+            name: "remove",
+            grammar: "remove <app> <versionCode>",
+            description: "Removes the version code from all tracks.",
+            examples: []string {"remove myapp 1234", "plan remove myapp 1234"},
+            mutating: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doRemove(ctx, arguments.app, arguments.versionCode, arguments.dryRun)
+            },
+        },
+        {
+            name: "resume",
+            grammar: "resume <app> <versionCode>",
+            description: "Resumes the halted rollout of the version code at the user percentage it was halted at.",
+            examples: []string {"resume myapp 1234"},
+            mutating: true,
+            permission: permissionGod,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doResume(ctx, arguments.app, arguments.versionCode, arguments.dryRun)
+            },
+        },
+        {
+            name: "rollout",
+            grammar: "rollout <app> <versionCode> to <percentage>%",
+            description: "Rolls the version code out to a percentage of the users on the production track.",
+            examples: []string {"rollout myapp 1234 to 10%"},
+            mutating: true,
+            permission: permissionGod,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doRollout(
+                        ctx,
+                        arguments.app,
+                        arguments.versionCode,
+                        "production",
+                        arguments.userPercentage,
+                        arguments.dryRun)
+            },
+        },
+        {
+            name: "rollout",
+            grammar: "rollout <app> <versionCode> on <track> to <percentage>%",
+            description: "Rolls the version code out to a percentage of the users on the track.",
+            examples: []string {"rollout myapp 1234 on beta to 20%", "rollout myapp 1234 on production to 10%"},
+            mutating: true,
+            permission: permissionGodUnlessTestTrack,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doRollout(
+                        ctx,
+                        arguments.app,
+                        arguments.versionCode,
+                        arguments.storeTrack,
+                        arguments.userPercentage,
+                        arguments.dryRun)
+            },
+        },
+        {
+            name: "schedule rollout",
+            grammar: "schedule rollout <app> <versionCode> <percentages> every <interval>",
+            description: "Rolls the version code out on the production track step by step, starting now.",
+            examples: []string {"schedule rollout myapp 1234 1,5,20,50,100 every 24h"},
+            immediate: true,
+            permission: permissionGod,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doScheduleRollout(
+                        arguments.user,
+                        arguments.app,
+                        arguments.versionCode,
+                        "production",
+                        arguments.userPercentages,
+                        arguments.interval)
+            },
+        },
+        {
+            name: "schedule rollout",
+            grammar: "schedule rollout <app> <versionCode> on <track> <percentages> every <interval>",
+            description: "Rolls the version code out on the track step by step, starting now.",
+            examples: []string {"schedule rollout myapp 1234 on beta 10,50,100 every 12h"},
+            immediate: true,
+            permission: permissionGodUnlessTestTrack,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doScheduleRollout(
+                        arguments.user,
+                        arguments.app,
+                        arguments.versionCode,
+                        arguments.storeTrack,
+                        arguments.userPercentages,
+                        arguments.interval)
+            },
+        },
+        {
+            name: "set release notes",
+            grammar: "set release notes for <app> <versionCode> <language>: <text>",
+            description: "Replaces the release notes of the version code in one language, or adds them.",
+            examples: []string {"set release notes for myapp 1234 en-US: Fixes a crash on startup."},
+            mutating: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doSetReleaseNotes(
+                        ctx,
+                        arguments.app,
+                        arguments.versionCode,
+                        arguments.language,
+                        arguments.text,
+                        arguments.dryRun)
+            },
+        },
+        {
+            name: "set release notes",
+            grammar: "set release notes for <app> <versionCode>",
+            description: "Replaces the release notes of the version code in all languages with the attached file, " +
+                    "either a JSON object of texts by language or a CSV with a language and a text per row.",
+            examples: []string {"set release notes for myapp 1234"},
+            mutating: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doSetReleaseNotesFromFile(
+                        ctx,
+                        arguments.app,
+                        arguments.versionCode,
+                        arguments.fileName,
+                        arguments.fileUrl,
+                        arguments.dryRun)
+            },
+        },
+        {
+            name: "share",
+            grammar: "share <app> <version>",
+            description: "Uploads the Maven artifact with that version for internal app sharing, without changing any track.",
+            examples: []string {"share myapp 1.2.3"},
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doShare(ctx, arguments.app, arguments.version)
+            },
+        },
+        {
+            name: "show release notes",
+            grammar: "show release notes for <app> <versionCode>",
+            description: "Shows the release notes of the version code in every language.",
+            examples: []string {"show release notes for myapp 1234"},
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doShowReleaseNotes(ctx, arguments.app, arguments.versionCode)
+            },
+        },
+        {
+            name: "show schedules",
+            grammar: "show schedules",
+            description: "Lists the scheduled rollouts and their next steps.",
+            examples: []string {"show schedules"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                doShowSchedules()
+                return true
+            },
+        },
+        {
+            name: "show tracks",
+            grammar: "show tracks for <app>",
+            description: "Shows the version codes in every track.",
+            examples: []string {"show tracks for myapp"},
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doShowTracks(ctx, arguments.app)
+            },
+        },
+        {
+            name: "status",
+            grammar: "status <job>",
+            description: "Shows the status of a job.",
+            examples: []string {"status 42"},
+            immediate: true,
+            permission: permissionEveryone,
+            handler: func(ctx context.Context, arguments *commandArguments) bool {
+                return doStatus(arguments.jobId)
+            },
+        },
+    }
+
+    for _, command := range commands {
+        command.compile()
+    }
+}
+
+func handleSlackCommand(user string, text string, files []slack.File) {
+    jobText := commandMentionExpression.ReplaceAllString(text, "")
+
+    dryRun := false
+
+    if commandDryRunPrefixExpression.MatchString(text) || commandDryRunSuffixExpression.MatchString(text) {
+        dryRun = true
+        text = commandDryRunPrefixExpression.ReplaceAllString(text, "$1 ")
+        text = commandDryRunSuffixExpression.ReplaceAllString(text, "")
+    }
+
+    for _, command := range commands {
+        values := command.expression.FindStringSubmatch(text)
+
+        if values == nil {
+            continue
+        }
+
+        if dryRun && !command.mutating {
+            postSlackMessage("Sorry, *%v* doesn't change anything, so there's nothing to rehearse.", command.name)
+            return
+        }
+
+        arguments := &commandArguments {dryRun: dryRun, user: user}
+
+        if len(files) > 0 {
+            arguments.fileName = files[0].Name
+            arguments.fileUrl = files[0].URLPrivateDownload
+        }
+
+        for index, parameter := range command.parameters {
+            if !parameter.parse(values[index + 1], arguments) {
+                postSlackMessage("Sorry, I don't understand that %v.", parameter.name)
+                return
+            }
+        }
+
+        if !command.isPermitted(arguments) {
+            postSlackMessage("Sorry, only gods can do that.")
+            return
+        }
+
+        if dryRun {
+            postSlackMessage("This is a dry run, I won't commit anything.")
+        }
+
+        if command.immediate {
+            command.handler(context.Background(), arguments)
+            return
+        }
+
+        job := submitJob(command, arguments, jobText)
+
+        if job != nil {
+            postSlackMessage("Ok, that's job *#%v*.", job.id)
+        }
+
+        return
+    }
+
+    doSuggest(text)
+}
+
+func findCommands(name string) []*command {
+    var result []*command
+
+    name = strings.Join(strings.Fields(strings.ToLower(name)), " ")
+
+    for _, command := range commands {
+        if command.name == name {
+            result = append(result, command)
+        }
+    }
+
+    return result
+}
+
+func findSimilarCommand(text string) *command {
+    words := strings.Fields(strings.ToLower(text))
+
+    if len(words) > 0 && strings.HasPrefix(words[0], "<@") {
+        words = words[1:]
+    }
+
+    var result *command
+
+    resultDistance := 0
+
+    for _, command := range commands {
+        nameWords := strings.Fields(command.name)
+
+        if len(words) < len(nameWords) {
+            continue
+        }
+
+        distance := getEditDistance(command.name, strings.Join(words[:len(nameWords)], " "))
+
+        if distance > len(command.name) / 2 {
+            continue
+        }
+
+        if result == nil || distance < resultDistance {
+            result = command
+            resultDistance = distance
+        }
+    }
+
+    return result
+}
+
+func getEditDistance(source string, target string) int {
+    sourceRunes := []rune(source)
+    targetRunes := []rune(target)
+
+    distances := make([]int, len(targetRunes) + 1)
+
+    for index := range distances {
+        distances[index] = index
+    }
+
+    for sourceIndex := 1; sourceIndex <= len(sourceRunes); sourceIndex++ {
+        previousDistance := distances[0]
+
+        distances[0] = sourceIndex
+
+        for targetIndex := 1; targetIndex <= len(targetRunes); targetIndex++ {
+            distance := previousDistance
+
+            if sourceRunes[sourceIndex - 1] != targetRunes[targetIndex - 1] {
+                distance = 1 + minInt(previousDistance, minInt(distances[targetIndex - 1], distances[targetIndex]))
+            }
+
+            previousDistance = distances[targetIndex]
+            distances[targetIndex] = distance
+        }
+    }
+
+    return distances[len(targetRunes)]
+}
+
+func isSlackGod(user string) bool {
+    return getConfigExpression("SLACK_GOD_USER_ID").MatchString(user)
+}
+
+func isStoreTestTrack(storeTrack string) bool {
+    return storeTrack == "alpha" || storeTrack == "beta" || storeTrack == "internal"
+}
+
+func minInt(left int, right int) int {
+    if left < right {
+        return left
+    }
+
+    return right
+}
+
+func (command *command) compile() {
+    var expression strings.Builder
+
+    expression.WriteString("^<[^>]+>")
+
+    for _, word := range strings.Fields(command.grammar) {
+        expression.WriteString(" +")
+
+        offset := 0
+
+        for _, match := range commandPlaceholderExpression.FindAllStringSubmatchIndex(word, -1) {
+            parameter, exists := commandParameters[word[match[2]:match[3]]]
+
+            if !exists {
+                panic(fmt.Sprintf("unknown parameter in grammar: %v", command.grammar))
+            }
+
+            expression.WriteString(regexp.QuoteMeta(word[offset:match[0]]))
+            expression.WriteString("(" + parameter.expression + ")")
+
+            command.parameters = append(command.parameters, parameter)
+            offset = match[1]
+        }
+
+        expression.WriteString(regexp.QuoteMeta(word[offset:]))
+    }
+
+    expression.WriteString(" *$")
+
+    command.expression = regexp.MustCompile(expression.String())
+}
+
+func (command *command) getPermissionText() string {
+    switch command.permission {
+    case permissionGod:
+        return "Only gods can do that."
+    case permissionGodUnlessTestTrack:
+        return "Only gods can do that, unless the track is _alpha_, _beta_ or _internal_."
+    }
+
+    return ""
+}
+
+func (command *command) getUsageText() string {
+    return "`" + escapeSlackText(command.grammar) + "`"
+}
+
+func (command *command) isPermitted(arguments *commandArguments) bool {
+    switch command.permission {
+    case permissionGod:
+        return isSlackGod(arguments.user)
+    case permissionGodUnlessTestTrack:
+        return isStoreTestTrack(arguments.storeTrack) || isSlackGod(arguments.user)
+    }
+
+    return true
+}
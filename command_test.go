@@ -0,0 +1,362 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "github.com/nlopes/slack"
+    "log"
+    "os"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+const (
+    testGodUserId = "UGOD"
+    testUserId = "UUSER"
+)
+
+func TestFindSimilarCommand(t *testing.T) {
+    tests := []struct {
+        name string
+        text string
+        expected string
+    }{
+        {
+            name: "corrects a typo",
+            text: "<@UBOT> promte app 5 to production",
+            expected: "promote",
+        },
+        {
+            name: "corrects a typo in a command of several words",
+            text: "<@UBOT> shwo tracks for app",
+            expected: "show tracks",
+        },
+        {
+            name: "corrects a typo in a command with arguments",
+            text: "<@UBOT> scedule rollout app 5 1,5,20 every 24h",
+            expected: "schedule rollout",
+        },
+        {
+            name: "finds a command with missing arguments",
+            text: "<@UBOT> promote app 5",
+            expected: "promote",
+        },
+        {
+            name: "ignores the case",
+            text: "<@UBOT> Show Tracks",
+            expected: "show tracks",
+        },
+        {
+            name: "suggests nothing for small talk",
+            text: "<@UBOT> good morning",
+        },
+        {
+            name: "suggests nothing for a mention alone",
+            text: "<@UBOT>",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            actual := ""
+
+            command := findSimilarCommand(test.text)
+
+            if command != nil {
+                actual = command.name
+            }
+
+            if actual != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, actual)
+            }
+        })
+    }
+}
+
+func TestGetEditDistance(t *testing.T) {
+    tests := []struct {
+        source string
+        target string
+        expected int
+    }{
+        {"", "", 0},
+        {"promote", "promote", 0},
+        {"promote", "promte", 1},
+        {"rollout", "rolout", 1},
+        {"promote", "", 7},
+        {"", "jobs", 4},
+        {"kitten", "sitting", 3},
+        {"halt", "what", 2},
+        {"grüezi", "gruezi", 1},
+    }
+
+    for _, test := range tests {
+        actual := getEditDistance(test.source, test.target)
+
+        if actual != test.expected {
+            t.Errorf("expected %v between %q and %q, got %v", test.expected, test.source, test.target, actual)
+        }
+
+        // The distance is the same both ways.
+
+        actual = getEditDistance(test.target, test.source)
+
+        if actual != test.expected {
+            t.Errorf("expected %v between %q and %q, got %v", test.expected, test.target, test.source, actual)
+        }
+    }
+}
+
+func TestHandleSlackCommand(t *testing.T) {
+    tests := []struct {
+        name string
+        user string
+        text string
+        files []slack.File
+        grammar string
+        arguments *commandArguments
+        message string
+    }{
+        {
+            name: "rolls out on production",
+            user: testGodUserId,
+            text: "<@UBOT> rollout app 5 to 20%",
+            grammar: "rollout <app> <versionCode> to <percentage>%",
+            arguments: &commandArguments {app: "app", user: testGodUserId, userPercentage: 20, versionCode: 5},
+        },
+        {
+            name: "rolls out on a track",
+            user: testUserId,
+            text: "<@UBOT> rollout app 5 on beta to 100%",
+            grammar: "rollout <app> <versionCode> on <track> to <percentage>%",
+            arguments: &commandArguments {app: "app", storeTrack: "beta", user: testUserId, userPercentage: 100, versionCode: 5},
+        },
+        {
+            name: "refuses a rollout to no users",
+            user: testGodUserId,
+            text: "<@UBOT> rollout app 5 to 0%",
+            message: "Sorry, I don't understand that user percentage.",
+        },
+        {
+            name: "refuses a rollout to more than all users",
+            user: testGodUserId,
+            text: "<@UBOT> rollout app 5 on beta to 101%",
+            message: "Sorry, I don't understand that user percentage.",
+        },
+        {
+            name: "refuses a rollout on production to mortals",
+            user: testUserId,
+            text: "<@UBOT> rollout app 5 to 20%",
+            message: "Sorry, only gods can do that.",
+        },
+        {
+            name: "refuses a rollout on production to mortals when the track is named",
+            user: testUserId,
+            text: "<@UBOT> rollout app 5 on production to 20%",
+            message: "Sorry, only gods can do that.",
+        },
+        {
+            name: "refuses a version code that isn't a number",
+            user: testGodUserId,
+            text: "<@UBOT> rollout app five to 20%",
+            message: "Sorry, I don't understand that version code.",
+        },
+        {
+            name: "promotes to a test track for mortals",
+            user: testUserId,
+            text: "<@UBOT>  promote   app 5 to beta ",
+            grammar: "promote <app> <versionCode> to <track>",
+            arguments: &commandArguments {app: "app", storeTrack: "beta", user: testUserId, versionCode: 5},
+        },
+        {
+            name: "refuses a promotion to production to mortals",
+            user: testUserId,
+            text: "<@UBOT> promote app 5 to production",
+            message: "Sorry, only gods can do that.",
+        },
+        {
+            name: "deploys a version",
+            user: testUserId,
+            text: "<@UBOT> deploy app 1.2.3",
+            grammar: "deploy <app> <version>",
+            arguments: &commandArguments {app: "app", user: testUserId, version: "1.2.3"},
+        },
+        {
+            name: "shows the tracks",
+            user: testUserId,
+            text: "<@UBOT> show tracks for app",
+            grammar: "show tracks for <app>",
+            arguments: &commandArguments {app: "app", user: testUserId},
+        },
+        {
+            name: "schedules increasing percentages",
+            user: testGodUserId,
+            text: "<@UBOT> schedule rollout app 5 1,5%,20 every 24h",
+            grammar: "schedule rollout <app> <versionCode> <percentages> every <interval>",
+            arguments: &commandArguments {
+                app: "app",
+                interval: 24 * time.Hour,
+                user: testGodUserId,
+                userPercentages: []int {1, 5, 20},
+                versionCode: 5,
+            },
+        },
+        {
+            name: "refuses decreasing percentages",
+            user: testGodUserId,
+            text: "<@UBOT> schedule rollout app 5 20,5 every 24h",
+            message: "Sorry, I don't understand that user percentages.",
+        },
+        {
+            name: "shows the history",
+            user: testUserId,
+            text: "<@UBOT> history for app",
+            grammar: "history for <app>",
+            arguments: &commandArguments {app: "app", user: testUserId},
+        },
+        {
+            name: "shows the history with a limit",
+            user: testUserId,
+            text: "<@UBOT>  history   for app 50 ",
+            grammar: "history for <app> <limit>",
+            arguments: &commandArguments {app: "app", limit: 50, user: testUserId},
+        },
+        {
+            name: "refuses a limit of nothing",
+            user: testUserId,
+            text: "<@UBOT> history for app 0",
+            message: "Sorry, I don't understand that limit.",
+        },
+        {
+            name: "sets the release notes in one language",
+            user: testUserId,
+            text: "<@UBOT> set release notes for app 5 en-US: Fixes a crash &amp; a leak.",
+            grammar: "set release notes for <app> <versionCode> <language>: <text>",
+            arguments: &commandArguments {
+                app: "app",
+                language: "en-US",
+                text: "Fixes a crash & a leak.",
+                user: testUserId,
+                versionCode: 5,
+            },
+        },
+        {
+            name: "sets the release notes from a file",
+            user: testUserId,
+            text: "<@UBOT> set release notes for app 5",
+            files: []slack.File {{Name: "notes.json", URLPrivateDownload: "https://files.slack.com/notes.json"}},
+            grammar: "set release notes for <app> <versionCode>",
+            arguments: &commandArguments {
+                app: "app",
+                fileName: "notes.json",
+                fileUrl: "https://files.slack.com/notes.json",
+                user: testUserId,
+                versionCode: 5,
+            },
+        },
+        {
+            name: "plans a promotion",
+            user: testGodUserId,
+            text: "<@UBOT> plan promote app 5 to production",
+            grammar: "promote <app> <versionCode> to <track>",
+            arguments: &commandArguments {app: "app", dryRun: true, storeTrack: "production", user: testGodUserId, versionCode: 5},
+        },
+        {
+            name: "rehearses a promotion",
+            user: testGodUserId,
+            text: "<@UBOT> promote app 5 to production --dry-run",
+            grammar: "promote <app> <versionCode> to <track>",
+            arguments: &commandArguments {app: "app", dryRun: true, storeTrack: "production", user: testGodUserId, versionCode: 5},
+        },
+        {
+            name: "rehearses a promotion with the dash of a phone",
+            user: testGodUserId,
+            text: "<@UBOT> promote app 5 to production —dry-run",
+            grammar: "promote <app> <versionCode> to <track>",
+            arguments: &commandArguments {app: "app", dryRun: true, storeTrack: "production", user: testGodUserId, versionCode: 5},
+        },
+        {
+            name: "refuses to rehearse what changes nothing",
+            user: testUserId,
+            text: "<@UBOT> plan show tracks for app",
+            message: "Sorry, *show tracks* doesn't change anything, so there's nothing to rehearse.",
+        },
+        {
+            name: "lists the commands",
+            user: testUserId,
+            text: "<@UBOT> help",
+            grammar: "help",
+            arguments: &commandArguments {user: testUserId},
+        },
+        {
+            name: "explains a command",
+            user: testUserId,
+            text: "<@UBOT> help show tracks",
+            grammar: "help <command>",
+            arguments: &commandArguments {command: "show tracks", user: testUserId},
+        },
+        {
+            name: "suggests a command for a typo",
+            user: testUserId,
+            text: "<@UBOT> promte app 5 to beta",
+            message: "Did you mean `promote &lt;app&gt; &lt;versionCode&gt; to &lt;track&gt;`?",
+        },
+        {
+            name: "suggests a command for missing arguments",
+            user: testUserId,
+            text: "<@UBOT> show tracks",
+            message: "Did you mean `show tracks for &lt;app&gt;`?",
+        },
+    }
+
+    os.Setenv("SLACK_GOD_USER_ID", "^" + testGodUserId + "$")
+
+    savedCommands := commands
+    defer func() { commands = savedCommands }()
+
+    // Record what the handlers would get instead of running them.
+
+    var grammar string
+    var arguments *commandArguments
+
+    commands = nil
+
+    for _, savedCommand := range savedCommands {
+        recordingCommand := *savedCommand
+        recordingCommand.immediate = true
+        recordingCommand.handler = func(ctx context.Context, commandArguments *commandArguments) bool {
+            grammar = recordingCommand.grammar
+            arguments = commandArguments
+            return true
+        }
+
+        commands = append(commands, &recordingCommand)
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            grammar = ""
+            arguments = nil
+
+            var output bytes.Buffer
+
+            log.SetOutput(&output)
+            handleSlackCommand(test.user, test.text, test.files)
+            log.SetOutput(os.Stderr)
+
+            if grammar != test.grammar {
+                t.Errorf("expected %q, got %q", test.grammar, grammar)
+            }
+
+            if !reflect.DeepEqual(arguments, test.arguments) {
+                t.Errorf("expected %+v, got %+v", test.arguments, arguments)
+            }
+
+            if !strings.Contains(output.String(), test.message) {
+                t.Errorf("expected %q in %q", test.message, output.String())
+            }
+        })
+    }
+}
@@ -3,8 +3,12 @@ package main
 import (
     "os"
     "regexp"
+    "strconv"
+    "strings"
 )
 
+var configAppNameExpression = regexp.MustCompile("[^A-Z0-9]+")
+
 func getConfig(name string) string {
     result := os.Getenv(name)
 
@@ -24,3 +28,34 @@ func getConfigExpression(name string) *regexp.Regexp {
 
     return regexp.MustCompile(result)
 }
+
+// Reads a per-app setting, e.g. ANDROID_ARTIFACT_FORMAT_MY_APP for the app my-app.
+func getOptionalAppConfig(name string, app string, defaultValue string) string {
+    return getOptionalConfig(name + "_" + configAppNameExpression.ReplaceAllString(strings.ToUpper(app), "_"), defaultValue)
+}
+
+func getOptionalConfig(name string, defaultValue string) string {
+    result := os.Getenv(name)
+
+    if len(result) == 0 {
+        return defaultValue
+    }
+
+    return result
+}
+
+func getOptionalConfigInt(name string, defaultValue int) int {
+    result := os.Getenv(name)
+
+    if len(result) == 0 {
+        return defaultValue
+    }
+
+    value, err := strconv.Atoi(result)
+
+    if err != nil {
+        panic(name)
+    }
+
+    return value
+}
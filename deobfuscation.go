@@ -0,0 +1,72 @@
+package main
+
+import (
+    "context"
+    "os"
+)
+
+// A side artifact that lets Play deobfuscate the crash reports of a version.
+type deobfuscationArtifact struct {
+    classifier string
+    extension string
+    fileType string
+    description string
+}
+
+var deobfuscationArtifacts = []*deobfuscationArtifact {
+    {
+        classifier: "mapping",
+        extension: "txt",
+        fileType: "proguard",
+        description: "ProGuard mapping",
+    },
+    {
+        classifier: "native-debug-symbols",
+        extension: "zip",
+        fileType: "nativeCode",
+        description: "native debug symbols zip",
+    },
+}
+
+// Uploads the mapping and native debug symbols next to the artifact for every version code, if there are any.
+func uploadMavenDeobfuscationFiles(
+        ctx context.Context,
+        edit *storeEdit,
+        artifactId string,
+        version string,
+        appVersionCodes []int64) bool {
+    for _, artifact := range deobfuscationArtifacts {
+        url := locateMavenArtifact(artifactId, version, artifact.classifier, artifact.extension)
+
+        if !existsMavenArtifact(ctx, url) {
+            postSlackMessage("There's no %v for version *%v*, so Play can't deobfuscate its crash reports.", artifact.description, version)
+            continue
+        }
+
+        file := downloadMavenArtifact(ctx, url)
+
+        if file == nil {
+            return false
+        }
+
+        defer os.Remove(file.Name())
+        defer file.Close()
+
+        for _, appVersionCode := range appVersionCodes {
+            postSlackMessage("Uploading the %v for version code *%v*.", artifact.description, appVersionCode)
+
+            _, err := file.Seek(0, 0)
+
+            if err != nil {
+                postSlackMessage("Sorry, I can't seek in the temporary file: %v", err)
+                return false
+            }
+
+            if !edit.uploadDeobfuscationFile(appVersionCode, artifact.fileType, file) {
+                return false
+            }
+        }
+    }
+
+    return true
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+    "context"
+    "google.golang.org/api/androidpublisher/v3"
+    "io"
+)
+
+// An edit that is always either committed or deleted, so no edit stays open on Google's side:
+//
+//     edit := beginStoreEdit(ctx, app, dryRun)
+//
+//     if edit == nil {
+//         return
+//     }
+//
+//     defer edit.close()
+type storeEdit struct {
+    publisher storePublisher
+    appId string
+    id string
+    dryRun bool
+    finished bool
+    previousTracks []*androidpublisher.Track
+    tracks []*androidpublisher.Track
+}
+
+func beginStoreEdit(ctx context.Context, app string, dryRun bool) *storeEdit {
+    publisher := createStorePublisher(ctx)
+
+    if publisher == nil {
+        return nil
+    }
+
+    appId := getStoreAppId(app)
+
+    appEdit, err := publisher.insertEdit(appId)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't insert the edit: %v", err)
+        return nil
+    }
+
+    edit := &storeEdit {
+        publisher: publisher,
+        appId: appId,
+        id: appEdit.Id,
+        dryRun: dryRun,
+    }
+
+    recordJobEditId(ctx, edit.id)
+
+    tracks, err := publisher.listTracks(appId, edit.id)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't list the tracks: %v", err)
+        edit.abandon()
+        return nil
+    }
+
+    edit.previousTracks = copyStoreTracks(tracks)
+    edit.tracks = tracks
+
+    return edit
+}
+
+func (edit *storeEdit) abandon() {
+    edit.finished = true
+
+    err := edit.publisher.deleteEdit(edit.appId, edit.id)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't abandon the edit *%v*, it stays open until it expires: %v", edit.id, err)
+    } else {
+        postSlackMessage("I abandoned the edit *%v*, nothing changed.", edit.id)
+    }
+}
+
+// Abandons the edit unless it's finished, also when the caller panics.
+func (edit *storeEdit) close() {
+    recovered := recover()
+
+    if !edit.finished {
+        edit.abandon()
+    }
+
+    if recovered != nil {
+        panic(recovered)
+    }
+}
+
+func (edit *storeEdit) commit() bool {
+    err := edit.publisher.validateEdit(edit.appId, edit.id)
+
+    if err != nil {
+        postSlackMessage("Sorry, the edit isn't valid: %v", err)
+        return false
+    }
+
+    if edit.dryRun {
+        edit.showChanges()
+        edit.abandon()
+        postSlackMessage("This was a dry run, so I didn't commit the edit.")
+        return true
+    }
+
+    edit.finished = true
+
+    err = edit.publisher.commitEdit(edit.appId, edit.id)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't commit the edit: %v", err)
+
+        // A failed commit may leave the edit open.
+
+        edit.abandon()
+        return false
+    }
+
+    return true
+}
+
+// Deletes an edit that was only used for reading.
+func (edit *storeEdit) discard() {
+    edit.finished = true
+
+    err := edit.publisher.deleteEdit(edit.appId, edit.id)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't delete the edit *%v*, it stays open until it expires: %v", edit.id, err)
+    }
+}
+
+func (edit *storeEdit) showChanges() {
+    tracks, err := edit.publisher.listTracks(edit.appId, edit.id)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't list the tracks: %v", err)
+        return
+    }
+
+    for _, track := range tracks {
+        previousTrack := findStoreTrack(edit.previousTracks, track.Track)
+
+        if formatStoreTrack(previousTrack) == formatStoreTrack(track) {
+            continue
+        }
+
+        postSlackMessage("Track *%v* would change from %v to %v.", track.Track, formatStoreTrack(previousTrack), formatStoreTrack(track))
+    }
+}
+
+func (edit *storeEdit) updateTrack(track *androidpublisher.Track) bool {
+    err := edit.publisher.updateTrack(edit.appId, edit.id, track)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't update the track: %v", err)
+        return false
+    }
+
+    return true
+}
+
+func (edit *storeEdit) uploadApk(media io.Reader) *androidpublisher.Apk {
+    apk, err := edit.publisher.uploadApk(edit.appId, edit.id, media)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't upload the APK: %v", err)
+        return nil
+    }
+
+    return apk
+}
+
+func (edit *storeEdit) uploadBundle(media io.Reader) *androidpublisher.Bundle {
+    bundle, err := edit.publisher.uploadBundle(edit.appId, edit.id, media)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't upload the bundle: %v", err)
+        return nil
+    }
+
+    return bundle
+}
+
+func (edit *storeEdit) uploadDeobfuscationFile(appVersionCode int64, fileType string, media io.Reader) bool {
+    err := edit.publisher.uploadDeobfuscationFile(edit.appId, edit.id, appVersionCode, fileType, media)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't upload the %v deobfuscation file: %v", fileType, err)
+        return false
+    }
+
+    return true
+}
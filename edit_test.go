@@ -0,0 +1,89 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "testing"
+)
+
+func TestStoreEditClose(t *testing.T) {
+    tests := []struct {
+        name string
+        failure string
+        handler func(edit *storeEdit) bool
+    }{
+        {
+            name: "abandons the edit when updating a track fails",
+            failure: "updateTrack",
+            handler: func(edit *storeEdit) bool {
+                return changeUserFraction(edit, findStoreTrack(edit.tracks, "beta"), 5, 0.5)
+            },
+        },
+        {
+            name: "abandons the edit when uploading fails",
+            failure: "upload",
+            handler: func(edit *storeEdit) bool {
+                return edit.uploadApk(bytes.NewReader(newTestApk(testAppId, 101, "1.1.0"))) != nil
+            },
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            publisher := startFakeStorePublisher(newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)))
+            publisher.failures[test.failure] = errors.New("the Play Console is down")
+
+            succeeded := func() bool {
+                edit := beginStoreEdit(context.Background(), "app", false)
+
+                if edit == nil {
+                    return false
+                }
+
+                defer edit.close()
+
+                return test.handler(edit) && edit.commit()
+            }()
+
+            if succeeded {
+                t.Errorf("expected the %v to fail", test.failure)
+            }
+
+            expectTestEditsClosed(t, publisher)
+
+            expected := "beta: 1.0.0 [5] completed"
+            actual := formatTestTracks(publisher.getTracks(testAppId))
+
+            if actual != expected {
+                t.Errorf("expected %q, got %q", expected, actual)
+            }
+        })
+    }
+
+    t.Run("abandons the edit when the handler panics and keeps panicking", func(t *testing.T) {
+        publisher := startFakeStorePublisher(newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)))
+
+        var recovered interface{}
+
+        func() {
+            defer func() { recovered = recover() }()
+
+            edit := beginStoreEdit(context.Background(), "app", false)
+
+            if edit == nil {
+                t.Fatal("expected an edit")
+            }
+
+            defer edit.close()
+
+            panic("the handler is broken")
+        }()
+
+        if recovered != "the handler is broken" {
+            t.Errorf("expected the panic to propagate, got %v", recovered)
+        }
+
+        expectTestEditsClosed(t, publisher)
+    })
+}
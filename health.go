@@ -0,0 +1,170 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// A limit for one metric, e.g. crashFreeRate>=0.99.
+type healthThreshold struct {
+    metric string
+    operator string
+    value float64
+}
+
+// How long a scheduled step waits when the metrics can't be checked.
+const healthRetryInterval = 15 * time.Minute
+
+var healthThresholdExpression = regexp.MustCompile("^ *([A-Za-z0-9_.-]+) *(<=|>=|<|>) *([0-9.eE+-]+) *$")
+
+// Asks the metrics endpoint of the app and returns the thresholds it breaches, e.g.:
+//
+//     HEALTH_METRICS_URL=https://metrics.example.com/android
+//     HEALTH_THRESHOLDS=crashFreeRate>=0.99,anrRate<=0.005
+//
+// The endpoint gets the app and the version code as query parameters and returns a JSON object with a number
+// for every metric of the thresholds. Other fields may be anything.
+// Returns false if the health can't be checked.
+func checkStoreReleaseHealth(ctx context.Context, app string, appVersionCode int64) ([]string, bool) {
+    metricsUrl := getOptionalAppConfig("HEALTH_METRICS_URL", app, getOptionalConfig("HEALTH_METRICS_URL", ""))
+
+    if len(metricsUrl) == 0 {
+        return nil, true
+    }
+
+    thresholds, err := parseHealthThresholds(
+            getOptionalAppConfig("HEALTH_THRESHOLDS", app, getOptionalConfig("HEALTH_THRESHOLDS", "")))
+
+    if err != nil {
+        postSlackMessage("Sorry, I don't understand the health thresholds: %v", err)
+        return nil, false
+    }
+
+    metrics := loadHealthMetrics(ctx, metricsUrl, app, appVersionCode)
+
+    if metrics == nil {
+        return nil, false
+    }
+
+    var result []string
+
+    for _, threshold := range thresholds {
+        field, exists := metrics[threshold.metric]
+
+        if !exists {
+            postSlackMessage("Sorry, the health metrics don't contain *%v*.", threshold.metric)
+            return nil, false
+        }
+
+        value, ok := field.(float64)
+
+        if !ok {
+            postSlackMessage("Sorry, the health metric *%v* isn't a number: %v", threshold.metric, field)
+            return nil, false
+        }
+
+        if !threshold.isMet(value) {
+            result = append(result, fmt.Sprintf(
+                    "*%v* is %v, expected %v %v",
+                    threshold.metric,
+                    value,
+                    threshold.operator,
+                    threshold.value))
+        }
+    }
+
+    return result, true
+}
+
+func loadHealthMetrics(ctx context.Context, metricsUrl string, app string, appVersionCode int64) map[string]interface{} {
+    client := &http.Client{}
+
+    request, err := http.NewRequest("GET", metricsUrl, nil)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't create the HTTP request: %v", err)
+        return nil
+    }
+
+    request = request.WithContext(ctx)
+
+    query := request.URL.Query()
+    query.Set("app", app)
+    query.Set("versionCode", strconv.FormatInt(appVersionCode, 10))
+
+    request.URL.RawQuery = query.Encode()
+
+    response, err := client.Do(request)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't get the health metrics: %v", err)
+        return nil
+    }
+
+    defer response.Body.Close()
+
+    if response.StatusCode != 200 {
+        postSlackMessage("Sorry, I didn't expect that HTTP status code: %v", response.StatusCode)
+        return nil
+    }
+
+    var result map[string]interface{}
+
+    err = json.NewDecoder(response.Body).Decode(&result)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't parse the health metrics: %v", err)
+        return nil
+    }
+
+    return result
+}
+
+func parseHealthThresholds(text string) ([]*healthThreshold, error) {
+    var result []*healthThreshold
+
+    for _, field := range strings.Split(text, ",") {
+        if len(strings.TrimSpace(field)) == 0 {
+            continue
+        }
+
+        values := healthThresholdExpression.FindStringSubmatch(field)
+
+        if values == nil {
+            return nil, fmt.Errorf("%v isn't like crashFreeRate>=0.99", field)
+        }
+
+        value, err := strconv.ParseFloat(values[3], 64)
+
+        if err != nil {
+            return nil, err
+        }
+
+        result = append(result, &healthThreshold {
+            metric: values[1],
+            operator: values[2],
+            value: value,
+        })
+    }
+
+    return result, nil
+}
+
+func (threshold *healthThreshold) isMet(value float64) bool {
+    switch threshold.operator {
+    case "<":
+        return value < threshold.value
+    case "<=":
+        return value <= threshold.value
+    case ">":
+        return value > threshold.value
+    }
+
+    return value >= threshold.value
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "testing"
+    "time"
+)
+
+func TestScheduleStepChecksHealth(t *testing.T) {
+    tests := []struct {
+        name string
+        metrics string
+        unreachable bool
+        succeeded bool
+        scheduled bool
+        expected string
+    }{
+        {
+            name: "rolls out a healthy release",
+            metrics: `{"crashFreeRate": 0.995, "anrRate": 0.001, "version": "1.0.0"}`,
+            succeeded: true,
+            scheduled: true,
+            expected: "production: 1.0.0 [5] inProgress 0.5",
+        },
+        {
+            name: "halts a release that breaches a threshold",
+            metrics: `{"crashFreeRate": 0.95, "anrRate": 0.001, "version": "1.0.0"}`,
+            expected: "production: 1.0.0 [5] halted 0.1",
+        },
+        {
+            name: "postpones the step if a metric isn't a number",
+            metrics: `{"crashFreeRate": "unknown", "anrRate": 0.001}`,
+            scheduled: true,
+            expected: "production: 1.0.0 [5] inProgress 0.1",
+        },
+        {
+            name: "postpones the step if the endpoint is unreachable",
+            unreachable: true,
+            scheduled: true,
+            expected: "production: 1.0.0 [5] inProgress 0.1",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+                if request.URL.Query().Get("versionCode") != "5" {
+                    http.NotFound(writer, request)
+                    return
+                }
+
+                fmt.Fprint(writer, test.metrics)
+            }))
+
+            if test.unreachable {
+                server.Close()
+            } else {
+                defer server.Close()
+            }
+
+            os.Setenv("HEALTH_METRICS_URL", server.URL)
+            os.Setenv("HEALTH_THRESHOLDS", "crashFreeRate>=0.99,anrRate<=0.005")
+
+            defer os.Unsetenv("HEALTH_METRICS_URL")
+            defer os.Unsetenv("HEALTH_THRESHOLDS")
+
+            publisher := startFakeStorePublisher(newTestTrack("production", newStoreRelease("1.0.0", 5, 0.1, nil)))
+
+            // The health is checked before every step but the first one.
+
+            schedule, err := addSchedule("U1", "app", 5, "production", []int {10, 50, 100}, time.Hour)
+
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            defer removeSchedule(schedule.Id)
+
+            _, err = advanceSchedule(schedule.Id)
+
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            succeeded := runScheduleStep(context.Background(), schedule.Id)
+
+            if succeeded != test.succeeded {
+                t.Errorf("expected %v, got %v", test.succeeded, succeeded)
+            }
+
+            if (findSchedule(schedule.Id) != nil) != test.scheduled {
+                t.Errorf("expected the schedule to exist: %v", test.scheduled)
+            }
+
+            actual := formatTestTracks(publisher.getTracks(testAppId))
+
+            if actual != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, actual)
+            }
+        })
+    }
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "runtime/debug"
+    "sync"
+    "time"
+)
+
+type job struct {
+    id int
+    user string
+    text string
+    command *command
+    arguments *commandArguments
+    context context.Context
+    cancel context.CancelFunc
+    lockedAppId string
+    editId string
+    storeTrack string
+    version string
+    versionCode int64
+    status string
+    created time.Time
+    started time.Time
+    finished time.Time
+}
+
+const (
+    jobStatusCancelled = "cancelled"
+    jobStatusFailed = "failed"
+    jobStatusQueued = "queued"
+    jobStatusRejected = "rejected"
+    jobStatusRunning = "running"
+    jobStatusSucceeded = "succeeded"
+)
+
+type jobContextKey struct {}
+
+// The number of finished jobs that are kept for the 'jobs' and 'status' commands.
+const jobHistorySize = 20
+
+// The jobs that hold the lock of an app, by application ID.
+var jobAppLocks = map[string]*job {}
+
+var jobMutex sync.Mutex
+
+var jobQueue chan *job
+
+var jobs []*job
+
+var lastJobId int
+
+func auditJob(job *job) {
+    if !job.command.mutating {
+        return
+    }
+
+    jobMutex.Lock()
+
+    entry := &auditEntry {
+        User: job.user,
+        Command: job.text,
+        App: job.arguments.app,
+        Version: job.arguments.version,
+        VersionCode: job.arguments.versionCode,
+        Track: job.arguments.storeTrack,
+        UserFraction: float64(job.arguments.userPercentage) / 100,
+        EditId: job.editId,
+        DryRun: job.arguments.dryRun,
+        Outcome: job.status,
+        Started: job.started,
+        Finished: job.finished,
+    }
+
+    // Jobs that never ran count from when they were submitted.
+
+    if entry.Started.IsZero() {
+        entry.Started = job.created
+    }
+
+    if len(job.storeTrack) > 0 {
+        entry.Track = job.storeTrack
+    }
+
+    if len(job.version) > 0 {
+        entry.Version = job.version
+    }
+
+    if job.versionCode != 0 {
+        entry.VersionCode = job.versionCode
+    }
+
+    jobMutex.Unlock()
+
+    err := appendAuditEntry(entry)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't write job *#%v* to the audit log: %v", job.id, err)
+    }
+}
+
+func cancelJob(job *job) bool {
+    jobMutex.Lock()
+
+    if job.status != jobStatusQueued && job.status != jobStatusRunning {
+        jobMutex.Unlock()
+        return false
+    }
+
+    queued := job.status == jobStatusQueued
+
+    if queued {
+        job.status = jobStatusCancelled
+        job.finished = time.Now()
+
+        unlockJobApp(job)
+    }
+
+    job.cancel()
+
+    jobMutex.Unlock()
+
+    // A running job is audited when its handler returns, a queued one never gets there.
+
+    if queued {
+        auditJob(job)
+    }
+
+    return true
+}
+
+func findJob(id int) *job {
+    jobMutex.Lock()
+    defer jobMutex.Unlock()
+
+    for _, job := range jobs {
+        if job.id == id {
+            return job
+        }
+    }
+
+    return nil
+}
+
+func formatJob(job *job) string {
+    jobMutex.Lock()
+    defer jobMutex.Unlock()
+
+    result := fmt.Sprintf("Job *#%v* `%v` by <@%v> is *%v*", job.id, escapeSlackText(job.text), job.user, job.status)
+
+    switch job.status {
+    case jobStatusQueued:
+        result += fmt.Sprintf(" since %v", job.created.Format(time.Kitchen))
+    case jobStatusRunning:
+        result += fmt.Sprintf(" for %v", time.Since(job.started).Round(time.Second))
+    default:
+        result += fmt.Sprintf(" since %v", job.finished.Format(time.Kitchen))
+    }
+
+    return result + "."
+}
+
+func isJobFinished(job *job) bool {
+    jobMutex.Lock()
+    defer jobMutex.Unlock()
+
+    return !job.finished.IsZero()
+}
+
+func listJobs() []*job {
+    jobMutex.Lock()
+    defer jobMutex.Unlock()
+
+    return append([]*job {}, jobs...)
+}
+
+// Remembers the edit of the job running in the context, if any, for the audit log.
+func recordJobEditId(ctx context.Context, editId string) {
+    job, _ := ctx.Value(jobContextKey {}).(*job)
+
+    if job == nil {
+        return
+    }
+
+    jobMutex.Lock()
+    job.editId = editId
+    jobMutex.Unlock()
+}
+
+// Remembers the track the job running in the context changed, if any, for the audit log.
+func recordJobTrack(ctx context.Context, storeTrack string) {
+    job, _ := ctx.Value(jobContextKey {}).(*job)
+
+    if job == nil {
+        return
+    }
+
+    jobMutex.Lock()
+    job.storeTrack = storeTrack
+    jobMutex.Unlock()
+}
+
+// Remembers the version the job running in the context resolved, if any, for the audit log.
+func recordJobVersion(ctx context.Context, version string) {
+    job, _ := ctx.Value(jobContextKey {}).(*job)
+
+    if job == nil {
+        return
+    }
+
+    jobMutex.Lock()
+    job.version = version
+    jobMutex.Unlock()
+}
+
+// Remembers the version code the job running in the context created, if any, for the audit log.
+func recordJobVersionCode(ctx context.Context, versionCode int64) {
+    job, _ := ctx.Value(jobContextKey {}).(*job)
+
+    if job == nil {
+        return
+    }
+
+    jobMutex.Lock()
+    job.versionCode = versionCode
+    jobMutex.Unlock()
+}
+
+func runJob(job *job) {
+    jobMutex.Lock()
+
+    if job.status != jobStatusQueued {
+        jobMutex.Unlock()
+        return
+    }
+
+    job.status = jobStatusRunning
+    job.started = time.Now()
+
+    jobMutex.Unlock()
+
+    succeeded := false
+
+    defer func() {
+        recovered := recover()
+
+        if recovered != nil {
+            log.Printf("Job #%v panicked: %v\n%s", job.id, recovered, debug.Stack())
+            postSlackMessage("Sorry, job *#%v* failed unexpectedly: %v", job.id, recovered)
+        }
+
+        jobMutex.Lock()
+
+        switch {
+        case succeeded:
+            job.status = jobStatusSucceeded
+        case job.context.Err() != nil:
+            job.status = jobStatusCancelled
+        default:
+            job.status = jobStatusFailed
+        }
+
+        job.finished = time.Now()
+        job.cancel()
+
+        unlockJobApp(job)
+
+        jobMutex.Unlock()
+
+        if job.status == jobStatusCancelled {
+            postSlackMessage("Job *#%v* was cancelled.", job.id)
+        }
+
+        auditJob(job)
+    }()
+
+    succeeded = job.command.handler(job.context, job.arguments)
+}
+
+func startJobWorkers() {
+    jobQueue = make(chan *job, getOptionalConfigInt("JOB_QUEUE_SIZE", 100))
+
+    for index := 0; index < getOptionalConfigInt("JOB_WORKER_COUNT", 4); index++ {
+        go func() {
+            for job := range jobQueue {
+                runJob(job)
+            }
+        }()
+    }
+}
+
+func submitJob(command *command, arguments *commandArguments, text string) *job {
+    result, lockingJob := trySubmitJob(command, arguments, text)
+
+    if lockingJob != nil {
+        auditJob(result)
+
+        postSlackMessage(
+                "Sorry, *%v* is busy: <@%v> is running job *#%v* `%v`. Try again when it's finished.",
+                arguments.app,
+                lockingJob.user,
+                lockingJob.id,
+                escapeSlackText(lockingJob.text))
+        return nil
+    }
+
+    return result
+}
+
+// Like submitJob, but leaves it to the caller to tell the user that the app is busy and to audit the rejection.
+// If the app is busy, returns the rejected job and the job that holds the lock of the app.
+func trySubmitJob(command *command, arguments *commandArguments, text string) (*job, *job) {
+    result := &job {
+        user: arguments.user,
+        text: text,
+        command: command,
+        arguments: arguments,
+        status: jobStatusQueued,
+        created: time.Now(),
+    }
+
+    ctx, cancel := context.WithCancel(context.WithValue(context.Background(), jobContextKey {}, result))
+
+    result.context = ctx
+    result.cancel = cancel
+
+    jobMutex.Lock()
+
+    // Only one job at a time may change an app, otherwise their edits clobber each other.
+
+    if command.mutating {
+        appId := getStoreAppId(arguments.app)
+        lockingJob := jobAppLocks[appId]
+
+        if lockingJob != nil {
+            result.status = jobStatusRejected
+            result.finished = time.Now()
+
+            jobMutex.Unlock()
+            cancel()
+
+            return result, lockingJob
+        }
+
+        jobAppLocks[appId] = result
+        result.lockedAppId = appId
+    }
+
+    lastJobId++
+
+    result.id = lastJobId
+
+    // Forget the oldest finished jobs.
+
+    var retainedJobs []*job
+
+    finishedJobCount := 0
+
+    for index := len(jobs) - 1; index >= 0; index-- {
+        if jobs[index].finished.IsZero() || finishedJobCount < jobHistorySize {
+            retainedJobs = append([]*job {jobs[index]}, retainedJobs...)
+        }
+
+        if !jobs[index].finished.IsZero() {
+            finishedJobCount++
+        }
+    }
+
+    jobs = append(retainedJobs, result)
+
+    jobMutex.Unlock()
+
+    select {
+    case jobQueue <- result:
+        return result, nil
+    default:
+        jobMutex.Lock()
+
+        result.status = jobStatusRejected
+        result.finished = time.Now()
+
+        unlockJobApp(result)
+
+        jobMutex.Unlock()
+        cancel()
+
+        auditJob(result)
+
+        postSlackMessage("Sorry, I'm too busy right now, try again later.")
+        return nil, nil
+    }
+}
+
+// Must be called while holding the job mutex.
+func unlockJobApp(job *job) {
+    if len(job.lockedAppId) > 0 && jobAppLocks[job.lockedAppId] == job {
+        delete(jobAppLocks, job.lockedAppId)
+    }
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+    "context"
+    "testing"
+)
+
+var testJobCommand = &command {
+    name: "test",
+    mutating: true,
+    permission: permissionEveryone,
+    handler: func(ctx context.Context, arguments *commandArguments) bool {
+        return true
+    },
+}
+
+func TestAuditJob(t *testing.T) {
+    savedJobQueue := jobQueue
+    defer func() { jobQueue = savedJobQueue }()
+
+    t.Run("cancelled while queued", func(t *testing.T) {
+        startTestAuditLog(t)
+
+        jobQueue = make(chan *job, 1)
+
+        job := submitJob(testJobCommand, &commandArguments {app: "app", user: "U1"}, "test app")
+
+        if job == nil {
+            t.Fatal("expected the job to be queued")
+        }
+
+        if !cancelJob(job) {
+            t.Fatal("expected the job to be cancelled")
+        }
+
+        expectTestAuditOutcomes(t, jobStatusCancelled)
+    })
+
+    t.Run("rejected because the app is busy", func(t *testing.T) {
+        startTestAuditLog(t)
+
+        jobQueue = make(chan *job, 1)
+
+        lockingJob := submitJob(testJobCommand, &commandArguments {app: "app", user: "U1"}, "test app")
+        defer cancelJob(lockingJob)
+
+        if submitJob(testJobCommand, &commandArguments {app: "app", user: "U2"}, "test app") != nil {
+            t.Fatal("expected the job to be rejected")
+        }
+
+        expectTestAuditOutcomes(t, jobStatusRejected)
+    })
+
+    t.Run("rejected because the queue is full", func(t *testing.T) {
+        startTestAuditLog(t)
+
+        jobQueue = make(chan *job)
+
+        if submitJob(testJobCommand, &commandArguments {app: "app", user: "U1"}, "test app") != nil {
+            t.Fatal("expected the job to be rejected")
+        }
+
+        expectTestAuditOutcomes(t, jobStatusRejected)
+
+        // The rejected job must not keep the app locked.
+
+        jobQueue = make(chan *job, 1)
+
+        job := submitJob(testJobCommand, &commandArguments {app: "app", user: "U1"}, "test app")
+
+        if job == nil {
+            t.Fatal("expected the app to be unlocked")
+        }
+
+        cancelJob(job)
+    })
+
+    t.Run("records the track of a production rollout", func(t *testing.T) {
+        startTestAuditLog(t)
+        startFakeStorePublisher(newTestTrack("production", newStoreRelease("1.0.0", 5, 0.1, nil)))
+
+        jobQueue = make(chan *job, 1)
+
+        arguments := &commandArguments {app: "app", user: "U1", userPercentage: 50, versionCode: 5}
+
+        if submitJob(findCommands("rollout")[0], arguments, "rollout app 5 to 50%") == nil {
+            t.Fatal("expected the job to be queued")
+        }
+
+        runJob(<-jobQueue)
+
+        entries, err := loadAuditEntries()
+
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if len(entries) != 1 || entries[0].Track != "production" {
+            t.Errorf("expected the production track in %+v", entries)
+        }
+    })
+}
+
+func expectTestAuditOutcomes(t *testing.T, outcomes ...string) {
+    entries, err := loadAuditEntries()
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(entries) != len(outcomes) {
+        t.Fatalf("expected %v audit entries, got %v", len(outcomes), len(entries))
+    }
+
+    for index, entry := range entries {
+        if entry.Outcome != outcomes[index] {
+            t.Errorf("expected outcome %v, got %v", outcomes[index], entry.Outcome)
+        }
+
+        if entry.Started.IsZero() {
+            t.Errorf("expected a start time")
+        }
+    }
+}
@@ -1,459 +1,1098 @@
 package main
 
 import (
+    "context"
     "fmt"
-    "golang.org/x/oauth2"
-    "google.golang.org/api/googleapi"
+    "google.golang.org/api/androidpublisher/v3"
     "log"
     "os"
-
-    androidpublisher2 "google.golang.org/api/androidpublisher/v2"
-    androidpublisher3 "google.golang.org/api/androidpublisher/v3"
+    "path"
+    "sort"
+    "strings"
+    "sync"
+    "time"
 )
 
-func doDeploy(artifactId string, version string) {
-    postSlackMessage("Ok, deploying *%v* with version *%v* ...", artifactId, version)
+func doCancel(jobId int, user string) bool {
+    job := findJob(jobId)
 
-    artifactUrl := locateMavenArtifact(artifactId, version)
-    artifactFile := downloadMavenArtifact(artifactUrl)
+    if job == nil {
+        postSlackMessage("Sorry, I can't find job *#%v*.", jobId)
+        return false
+    }
 
-    if artifactFile == nil {
-        return
+    if job.user != user && !isSlackGod(user) {
+        postSlackMessage("Sorry, only <@%v> or gods can cancel job *#%v*.", job.user, jobId)
+        return false
     }
 
-    defer os.Remove(artifactFile.Name())
+    if !cancelJob(job) {
+        postSlackMessage("Job *#%v* is already finished.", jobId)
+        return false
+    }
 
-    credentials := loadStoreCredentials()
+    postSlackMessage("Ok, cancelling job *#%v* ...", jobId)
+    return true
+}
 
-    if credentials == nil {
-        return
+func doCancelSchedule(scheduleId int, user string) bool {
+    schedule := findSchedule(scheduleId)
+
+    if schedule == nil {
+        postSlackMessage("Sorry, I can't find schedule *#%v*.", scheduleId)
+        return false
     }
 
-    client := credentials.Client(oauth2.NoContext)
+    if schedule.User != user && !isSlackGod(user) {
+        postSlackMessage("Sorry, only <@%v> or gods can cancel schedule *#%v*.", schedule.User, scheduleId)
+        return false
+    }
 
-    publisher, err := androidpublisher2.New(client)
+    removed, err := removeSchedule(scheduleId)
 
     if err != nil {
-        postSlackMessage("Sorry, I can't create the publisher: %v", err)
-        return
+        postSlackMessage("Sorry, I can't save the schedules: %v", err)
+        return false
     }
 
-    appId := fmt.Sprintf("%v.%v", getConfig("ANDROID_APP_ID_PREFIX"), artifactId)
+    if !removed {
+        postSlackMessage("Schedule *#%v* is already finished.", scheduleId)
+        return false
+    }
 
-    edit, err := publisher.Edits.
-            Insert(appId, nil).
-            Do()
+    auditSchedule(schedule, user, fmt.Sprintf("cancel schedule #%v", scheduleId))
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't insert the edit: %v", err)
-        return
+    postSlackMessage("Ok, I cancelled schedule *#%v*, the rollout stays where it is.", scheduleId)
+    return true
+}
+
+func doComplete(ctx context.Context, appId string, appVersionCode int64, dryRun bool) bool {
+    postSlackMessage("Ok, completing the rollout of *%v* with version code *%v* ...", appId, appVersionCode)
+
+    edit := beginStoreEdit(ctx, appId, dryRun)
+
+    if edit == nil {
+        return false
     }
 
-    apk, err := publisher.Edits.Apks.
-            Upload(appId, edit.Id).
-            Media(artifactFile, googleapi.ContentType("application/vnd.android.package-archive")).
-            Do()
+    defer edit.close()
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't upload the APK: %v", err)
-        return
+    track, release := findStoreRelease(edit.tracks, appVersionCode)
+
+    if release == nil {
+        postSlackMessage("Sorry, I can't find that version code.")
+        return false
     }
 
-    tracks, err := publisher.Edits.Tracks.
-            List(appId, edit.Id).
-            Do()
+    recordJobTrack(ctx, track.Track)
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't list the tracks: %v", err)
-        return
+    if !checkStoreReleaseInProgress(appId, appVersionCode, track, release) {
+        return false
     }
 
-    track := &androidpublisher2.Track {Track: "internal"}
+    if !completeStoreRelease(edit, track, appVersionCode) {
+        return false
+    }
+
+    if !edit.commit() {
+        return false
+    }
+
+    postSlackMessage("Done.")
+    return true
+}
+
+func doDeploy(ctx context.Context, artifactId string, version string, dryRun bool) bool {
+    postSlackMessage("Ok, deploying *%v* with version *%v* ...", artifactId, version)
+
+    version, artifactFormat, ok := resolveMavenArtifact(ctx, artifactId, version)
+
+    if !ok {
+        return false
+    }
+
+    postSlackMessage("Using the *%v* artifact.", artifactFormat)
 
-    for _, candidate := range tracks.Tracks {
-        if (candidate.Track == "internal") {
-            track = candidate
+    // App bundles contain all splits, only APKs come with a classifier each.
+
+    classifiers := []string {""}
+
+    if artifactFormat == "apk" {
+        classifiers = findMavenArtifactClassifiers(artifactId)
+    }
+
+    var artifactFiles []*os.File
+
+    var manifestVersionCodes []int64
+
+    for _, classifier := range classifiers {
+        if len(classifier) > 0 {
+            postSlackMessage("Downloading the *%v* artifact.", classifier)
         }
+
+        artifactUrl := locateMavenArtifact(artifactId, version, classifier, artifactFormat)
+        artifactFile := downloadMavenArtifact(ctx, artifactUrl)
+
+        if artifactFile == nil {
+            return false
+        }
+
+        defer os.Remove(artifactFile.Name())
+        defer artifactFile.Close()
+
+        // Catch the wrong artifact before Play does, or worse, doesn't.
+
+        manifest, err := readAndroidManifest(artifactFile, artifactFormat)
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't read the manifest of the artifact: %v", err)
+            return false
+        }
+
+        if !checkAndroidManifest(manifest, getStoreAppId(artifactId), version) {
+            return false
+        }
+
+        // Split APKs need a version code each, otherwise Play can't tell them apart.
+
+        for otherIndex, otherVersionCode := range manifestVersionCodes {
+            if otherVersionCode == manifest.versionCode {
+                postSlackMessage(
+                        "Sorry, the *%v* and *%v* artifacts both have version code *%v*.",
+                        classifiers[otherIndex],
+                        classifier,
+                        manifest.versionCode)
+                return false
+            }
+        }
+
+        manifestVersionCodes = append(manifestVersionCodes, manifest.versionCode)
+
+        if !checkArtifactSignature(artifactFile, artifactId) {
+            return false
+        }
+
+        artifactFiles = append(artifactFiles, artifactFile)
+    }
+
+    releaseNotes, valid := loadMavenReleaseNotes(ctx, artifactId, version)
+
+    if !valid {
+        return false
+    }
+
+    edit := beginStoreEdit(ctx, artifactId, dryRun)
+
+    if edit == nil {
+        return false
+    }
+
+    defer edit.close()
+
+    var versionCodes []int64
+
+    for _, artifactFile := range artifactFiles {
+        var versionCode int64
+
+        if artifactFormat == "aab" {
+            bundle := edit.uploadBundle(artifactFile)
+
+            if bundle == nil {
+                return false
+            }
+
+            versionCode = bundle.VersionCode
+        } else {
+            apk := edit.uploadApk(artifactFile)
+
+            if apk == nil {
+                return false
+            }
+
+            versionCode = apk.VersionCode
+        }
+
+        versionCodes = append(versionCodes, versionCode)
+
+        recordJobVersionCode(ctx, versionCode)
     }
 
+    if !uploadMavenDeobfuscationFiles(ctx, edit, artifactId, version, versionCodes) {
+        return false
+    }
+
+    track := findStoreTrack(edit.tracks, "internal")
+
+    recordJobTrack(ctx, track.Track)
+
     // Remove the lower versions from the target track.
 
-    if !removeAllVersionCodesFromStoreTrack(publisher, edit, track, appId) {
-        return
+    if !removeAllVersionCodesFromStoreTrack(edit, track) {
+        return false
     }
 
     // Add the current version to the target track.
 
-    if !addVersionCodeToStoreTrack(publisher, edit, track, appId, apk.VersionCode, 0) {
-        return
-    }
+    release := newStoreRelease(version, versionCodes[0], 0, releaseNotes)
+    release.VersionCodes = versionCodes
 
-    _, err = publisher.Edits.
-            Commit(appId, edit.Id).
-            Do()
+    if !addVersionCodeToStoreTrack(edit, track, release) {
+        return false
+    }
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't commit the edit: %v", err)
-        return
+    if !edit.commit() {
+        return false
     }
 
     postSlackMessage("Done.")
+    return true
 }
 
-func doHalt(appId string, appVersionCode int64) {
-    postSlackMessage("Ok, halting *%v* with version code *%v* ...", appId, appVersionCode)
-
-    credentials := loadStoreCredentials()
+func doExportHistory(format string) bool {
+    entries, err := loadAuditEntries()
 
-    if credentials == nil {
-        return
+    if err != nil {
+        postSlackMessage("Sorry, I can't read the audit log: %v", err)
+        return false
     }
 
-    client := credentials.Client(oauth2.NoContext)
+    var content strings.Builder
 
-    publisher, err := androidpublisher2.New(client)
+    switch format {
+    case "csv":
+        err = writeAuditEntriesAsCsv(&content, entries)
+    case "json":
+        err = writeAuditEntriesAsJson(&content, entries)
+    default:
+        postSlackMessage("Sorry, I can only export the history as *csv* or *json*.")
+        return false
+    }
 
     if err != nil {
-        postSlackMessage("Sorry, I can't create the publisher: %v", err)
-        return
+        postSlackMessage("Sorry, I can't export the audit log: %v", err)
+        return false
     }
 
-    appId = fmt.Sprintf("%v.%v", getConfig("ANDROID_APP_ID_PREFIX"), appId)
+    return postSlackFile("history." + format, format, content.String())
+}
+
+func doHalt(ctx context.Context, appId string, appVersionCode int64, dryRun bool) bool {
+    postSlackMessage("Ok, halting *%v* with version code *%v* ...", appId, appVersionCode)
 
-    edit, err := publisher.Edits.
-            Insert(appId, nil).
-            Do()
+    edit := beginStoreEdit(ctx, appId, dryRun)
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't insert the edit: %v", err)
-        return
+    if edit == nil {
+        return false
     }
 
-    tracks, err := publisher.Edits.Tracks.
-            List(appId, edit.Id).
-            Do()
+    defer edit.close()
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't list the tracks: %v", err)
-        return
+    track, release := findStoreRelease(edit.tracks, appVersionCode)
+
+    if release == nil {
+        postSlackMessage("Sorry, I can't find that version code.")
+        return false
     }
 
-    // Remove the version from all tracks.
+    recordJobTrack(ctx, track.Track)
 
-    if !removeVersionCodeFromStoreTracks(publisher, edit, tracks.Tracks, appId, appVersionCode) {
-        return
+    // Play only halts staged rollouts, the user fraction stays for resuming.
+
+    if release.Status != storeReleaseStatusInProgress {
+        postSlackMessage(
+                "Sorry, version code *%v* in track *%v* isn't being rolled out, it's *%v*.",
+                appVersionCode,
+                track.Track,
+                release.Status)
+        return false
     }
 
-    _, err = publisher.Edits.
-            Commit(appId, edit.Id).
-            Do()
+    if !changeReleaseStatus(edit, track, appVersionCode, storeReleaseStatusHalted) {
+        return false
+    }
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't commit the edit: %v", err)
-        return
+    if !edit.commit() {
+        return false
+    }
+
+    // A schedule would resume the rollout at its next step.
+
+    if !dryRun {
+        cancelSchedulesOf(appId, appVersionCode)
     }
 
     postSlackMessage("Done.")
+    return true
 }
 
-func doHelp() {
-    postSlackMessage("Sorry, I don't understand.")
-}
+func doHelp(name string) {
+    if len(name) == 0 {
+        var text strings.Builder
 
-func doPing() {
-    postSlackMessage("Pong.")
-}
+        text.WriteString("Here's what I can do:\n")
 
-func doPromote(appId string, appVersionCode int64, storeTrack string) {
-    postSlackMessage("Ok, promoting *%v* with version code *%v* to track *%v* ...", appId, appVersionCode, storeTrack)
+        for _, command := range commands {
+            text.WriteString("• " + command.getUsageText())
 
-    credentials := loadStoreCredentials()
+            if command.permission != permissionEveryone {
+                text.WriteString(" (gods only)")
+            }
+
+            text.WriteString(" – " + command.description + "\n")
+        }
 
-    if credentials == nil {
+        text.WriteString("Commands marked with _gods only_ need god rights, at least for some arguments. ")
+        text.WriteString("Try `help " + escapeSlackText("<command>") + "` for details.")
+
+        postSlackMessage("%v", text.String())
         return
     }
 
-    client := credentials.Client(oauth2.NoContext)
+    matchingCommands := findCommands(name)
 
-    publisher, err := androidpublisher2.New(client)
+    if len(matchingCommands) == 0 {
+        similarCommand := findSimilarCommand(name)
+
+        if similarCommand == nil {
+            postSlackMessage("Sorry, I don't know the command *%v*. Try `help`.", name)
+        } else {
+            postSlackMessage("Sorry, I don't know the command *%v*. Did you mean *%v*?", name, similarCommand.name)
+        }
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't create the publisher: %v", err)
         return
     }
 
-    appId = fmt.Sprintf("%v.%v", getConfig("ANDROID_APP_ID_PREFIX"), appId)
+    var text strings.Builder
+
+    for _, command := range matchingCommands {
+        text.WriteString("Usage: " + command.getUsageText() + "\n")
+        text.WriteString(command.description + "\n")
+
+        if command.permission != permissionEveryone {
+            text.WriteString(command.getPermissionText() + "\n")
+        }
+
+        if command.mutating {
+            text.WriteString("Add `--dry-run` at the end or `plan` at the start to see the changes without committing them.\n")
+        }
+
+        for _, placeholder := range commandPlaceholderExpression.FindAllStringSubmatch(command.grammar, -1) {
+            text.WriteString("• `" + escapeSlackText(placeholder[0]) + "` – " + commandParameters[placeholder[1]].description + "\n")
+        }
+
+        for _, example := range command.examples {
+            text.WriteString(fmt.Sprintf("Example: `<@%v> %v`\n", getConfig("SLACK_BOT_USER_ID"), example))
+        }
+    }
+
+    postSlackMessage("%v", text.String())
+}
 
-    edit, err := publisher.Edits.
-            Insert(appId, nil).
-            Do()
+func doHistory(appId string, limit int) bool {
+    entries, err := loadAuditEntries()
 
     if err != nil {
-        postSlackMessage("Sorry, I can't insert the edit: %v", err)
+        postSlackMessage("Sorry, I can't read the audit log: %v", err)
+        return false
+    }
+
+    var appEntries []*auditEntry
+
+    for _, entry := range entries {
+        if entry.App == appId {
+            appEntries = append(appEntries, entry)
+        }
+    }
+
+    if len(appEntries) == 0 {
+        postSlackMessage("There's no history for *%v*.", appId)
+        return true
+    }
+
+    if limit > maxListedAuditEntries {
+        postSlackMessage("I'm only listing the last %v entries.", maxListedAuditEntries)
+        limit = maxListedAuditEntries
+    }
+
+    if len(appEntries) > limit {
+        appEntries = appEntries[len(appEntries) - limit:]
+    }
+
+    var text strings.Builder
+
+    for _, entry := range appEntries {
+        text.WriteString(fmt.Sprintf(
+                "%v <@%v> `%v` *%v*",
+                entry.Started.Format("2006-01-02 15:04"),
+                entry.User,
+                escapeSlackText(entry.Command),
+                entry.Outcome))
+
+        if len(entry.EditId) > 0 {
+            text.WriteString(fmt.Sprintf(" (edit %v)", entry.EditId))
+        }
+
+        text.WriteString("\n")
+    }
+
+    postSlackMessage("%v", text.String())
+    return true
+}
+
+func doJobs() {
+    jobs := listJobs()
+
+    if len(jobs) == 0 {
+        postSlackMessage("There are no jobs.")
         return
     }
 
-    tracks, err := publisher.Edits.Tracks.
-            List(appId, edit.Id).
-            Do()
+    for _, job := range jobs {
+        postSlackMessage("%v", formatJob(job))
+    }
+}
+
+func doListVersions(ctx context.Context, artifactId string, limit int) bool {
+    postSlackMessage("Ok, listing versions of *%v* ...", artifactId)
+
+    metadata, ok := loadMavenMetadata(ctx, artifactId, "")
+
+    if !ok {
+        return false
+    }
+
+    if metadata == nil {
+        postSlackMessage("Sorry, I can't find the Maven metadata of *%v*.", artifactId)
+        return false
+    }
+
+    versions := metadata.Versioning.Versions
+
+    if len(versions) == 0 {
+        postSlackMessage("There are no versions of *%v*.", artifactId)
+        return true
+    }
+
+    entries, err := loadAuditEntries()
 
     if err != nil {
-        postSlackMessage("Sorry, I can't list the tracks: %v", err)
-        return
+        postSlackMessage("Sorry, I can't read the audit log: %v", err)
+        return false
+    }
+
+    edit := beginStoreEdit(ctx, artifactId, false)
+
+    if edit == nil {
+        return false
+    }
+
+    defer edit.close()
+
+    // The deploys of the history know the version of every version code they uploaded.
+
+    deployedVersions := map[int64]string {}
+
+    for _, entry := range entries {
+        if entry.App == artifactId && len(entry.Version) > 0 && entry.VersionCode != 0 &&
+                entry.Outcome == jobStatusSucceeded && !entry.DryRun {
+            deployedVersions[entry.VersionCode] = entry.Version
+        }
     }
 
-    track := &androidpublisher2.Track {Track: storeTrack}
+    // Play names releases after the version name of their artifacts, unless someone renamed them.
+
+    versionTracks := map[string][]string {}
+
+    for _, track := range edit.tracks {
+        trackVersions := map[string]bool {}
+
+        for _, release := range track.Releases {
+            trackVersions[getMavenBaseVersion(release.Name)] = true
+
+            for _, versionCode := range release.VersionCodes {
+                version, exists := deployedVersions[versionCode]
+
+                if exists {
+                    trackVersions[getMavenBaseVersion(version)] = true
+                }
+            }
+        }
 
-    for _, candidate := range tracks.Tracks {
-        if (candidate.Track == storeTrack) {
-            track = candidate;
+        for version := range trackVersions {
+            versionTracks[version] = append(versionTracks[version], track.Track)
         }
     }
 
-    for _, candidate := range track.VersionCodes {
-        if candidate == appVersionCode {
-            postSlackMessage("Version code *%v* already exists in track *%v*.", appVersionCode, storeTrack)
-            return
+    edit.discard()
+
+    if limit > maxListedMavenVersions {
+        postSlackMessage("I'm only listing the newest %v versions.", maxListedMavenVersions)
+        limit = maxListedMavenVersions
+    }
+
+    if len(versions) > limit {
+        versions = versions[len(versions) - limit:]
+    }
+
+    // Ask for the upload times side by side, but without flooding the repository.
+
+    lastModifiedTimes := make([]time.Time, len(versions))
+    requests := make(chan bool, mavenRequestConcurrency)
+
+    var waitGroup sync.WaitGroup
+
+    for index, version := range versions {
+        waitGroup.Add(1)
+
+        go func(index int, version string) {
+            defer waitGroup.Done()
+
+            requests <- true
+            lastModifiedTimes[index] = loadMavenLastModified(ctx, artifactId, version)
+            <-requests
+        }(index, version)
+    }
+
+    waitGroup.Wait()
+
+    var text strings.Builder
+
+    text.WriteString(fmt.Sprintf(
+            "*%v* was last updated %v.\n",
+            artifactId,
+            formatMavenTimestamp(metadata.Versioning.LastUpdated)))
+
+    for index := len(versions) - 1; index >= 0; index-- {
+        version := versions[index]
+
+        text.WriteString(fmt.Sprintf("*%v*", version))
+
+        if !lastModifiedTimes[index].IsZero() {
+            text.WriteString(fmt.Sprintf(" updated %v", lastModifiedTimes[index].UTC().Format(mavenTimeLayout)))
+        }
+
+        storeTracks := versionTracks[version]
+
+        if len(storeTracks) > 0 {
+            sort.Strings(storeTracks)
+            text.WriteString(fmt.Sprintf(" on track *%v*", strings.Join(storeTracks, "*, *")))
         }
+
+        text.WriteString("\n")
     }
 
+    postSlackMessage("%v", text.String())
+    return true
+}
+
+func doPing() {
+    postSlackMessage("Pong.")
+}
+
+func doPromote(ctx context.Context, appId string, appVersionCode int64, storeTrack string, dryRun bool) bool {
+    postSlackMessage("Ok, promoting *%v* with version code *%v* to track *%v* ...", appId, appVersionCode, storeTrack)
+
+    edit := beginStoreEdit(ctx, appId, dryRun)
+
+    if edit == nil {
+        return false
+    }
+
+    defer edit.close()
+
+    track := findStoreTrack(edit.tracks, storeTrack)
+
+    if findStoreTrackRelease(track, appVersionCode) != nil {
+        postSlackMessage("Version code *%v* already exists in track *%v*.", appVersionCode, storeTrack)
+        return false
+    }
+
+    release := getPromotedStoreRelease(edit.tracks, appVersionCode, 0)
+
     // Remove all lower versions from the target track.
 
-    if !removeAllVersionCodesFromStoreTrack(publisher, edit, track, appId) {
-       return
+    if !removeAllVersionCodesFromStoreTrack(edit, track) {
+       return false
     }
 
     // Move the current version to the target tracks.
 
-    if !removeVersionCodeFromStoreTracks(publisher, edit, tracks.Tracks, appId, appVersionCode) {
-        return
+    for _, versionCode := range release.VersionCodes {
+        if !removeVersionCodeFromStoreTracks(edit, versionCode) {
+            return false
+        }
     }
 
-    if !addVersionCodeToStoreTrack(publisher, edit, track, appId, appVersionCode, 0) {
-        return
+    if !addVersionCodeToStoreTrack(edit, track, release) {
+        return false
     }
 
-    _, err = publisher.Edits.
-            Commit(appId, edit.Id).
-            Do()
-
-    if err != nil {
-        postSlackMessage("Sorry, I can't commit the edit: %v", err)
-        return
+    if !edit.commit() {
+        return false
     }
 
     postSlackMessage("Done.")
+    return true
 }
 
-func doRollout(appId string, appVersionCode int64, userPercentage int) {
-    postSlackMessage("Ok, rolling out *%v* with version code *%v* to *%v%%* ...", appId, appVersionCode, userPercentage)
+func doRemove(ctx context.Context, appId string, appVersionCode int64, dryRun bool) bool {
+    postSlackMessage("Ok, removing *%v* with version code *%v* ...", appId, appVersionCode)
 
-    credentials := loadStoreCredentials()
+    edit := beginStoreEdit(ctx, appId, dryRun)
 
-    if credentials == nil {
-        return
+    if edit == nil {
+        return false
     }
 
-    client := credentials.Client(oauth2.NoContext)
+    defer edit.close()
 
-    publisher, err := androidpublisher2.New(client)
+    // Remove the version from all tracks.
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't create the publisher: %v", err)
-        return
+    if !removeVersionCodeFromStoreTracks(edit, appVersionCode) {
+        return false
     }
 
-    appId = fmt.Sprintf("%v.%v", getConfig("ANDROID_APP_ID_PREFIX"), appId)
+    if !edit.commit() {
+        return false
+    }
 
-    edit, err := publisher.Edits.
-            Insert(appId, nil).
-            Do()
+    postSlackMessage("Done.")
+    return true
+}
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't insert the edit: %v", err)
-        return
+func doResume(ctx context.Context, appId string, appVersionCode int64, dryRun bool) bool {
+    postSlackMessage("Ok, resuming *%v* with version code *%v* ...", appId, appVersionCode)
+
+    edit := beginStoreEdit(ctx, appId, dryRun)
+
+    if edit == nil {
+        return false
     }
 
-    tracks, err := publisher.Edits.Tracks.
-            List(appId, edit.Id).
-            Do()
+    defer edit.close()
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't list the tracks: %v", err)
-        return
+    track, release := findStoreRelease(edit.tracks, appVersionCode)
+
+    if release == nil {
+        postSlackMessage("Sorry, I can't find that version code.")
+        return false
     }
 
-    track := &androidpublisher2.Track {Track: "rollout"}
+    recordJobTrack(ctx, track.Track)
 
-    for _, candidate := range tracks.Tracks {
-        if (candidate.Track == "rollout") {
-            track = candidate;
-        }
+    if release.Status != storeReleaseStatusHalted {
+        postSlackMessage(
+                "Sorry, version code *%v* in track *%v* isn't halted, it's *%v*.",
+                appVersionCode,
+                track.Track,
+                release.Status)
+        return false
     }
 
-    exists := false
+    // Continue at the user fraction the release was halted at.
 
-    for _, candidate := range track.VersionCodes {
-        if candidate == appVersionCode {
-            exists = true
-        }
+    status, _ := getStoreReleaseStatus(release.UserFraction)
+
+    if !changeReleaseStatus(edit, track, appVersionCode, status) {
+        return false
     }
 
+    if !edit.commit() {
+        return false
+    }
+
+    postSlackMessage("Done.")
+    return true
+}
+
+func doRollout(
+        ctx context.Context,
+        appId string,
+        appVersionCode int64,
+        storeTrack string,
+        userPercentage int,
+        dryRun bool) bool {
+    postSlackMessage(
+            "Ok, rolling out *%v* with version code *%v* on track *%v* to *%v%%* ...",
+            appId,
+            appVersionCode,
+            storeTrack,
+            userPercentage)
+
+    edit := beginStoreEdit(ctx, appId, dryRun)
+
+    if edit == nil {
+        return false
+    }
+
+    defer edit.close()
+
+    track := findStoreTrack(edit.tracks, storeTrack)
+
+    recordJobTrack(ctx, track.Track)
+
     userFraction := float64(userPercentage) / 100
 
-    if !exists {
+    release := findStoreTrackRelease(track, appVersionCode)
+
+    if release != nil && !checkStoreReleaseInProgress(appId, appVersionCode, track, release) {
+        return false
+    }
+
+    if release == nil {
+        release = getPromotedStoreRelease(edit.tracks, appVersionCode, userFraction)
 
         // Remove all lower versions from the target track.
 
-        if !removeAllVersionCodesFromStoreTrack(publisher, edit, track, appId) {
-            return
+        if !removeAllVersionCodesFromStoreTrack(edit, track) {
+            return false
         }
 
         // Move the current version to the target tracks.
 
-        if !removeVersionCodeFromStoreTracks(publisher, edit, tracks.Tracks, appId, appVersionCode) {
-            return
+        for _, versionCode := range release.VersionCodes {
+            if !removeVersionCodeFromStoreTracks(edit, versionCode) {
+                return false
+            }
+        }
+
+        if !addVersionCodeToStoreTrack(edit, track, release) {
+            return false
         }
+    } else if userPercentage == 100 {
+
+        // Complete the rollout, superseding the completed release.
 
-        if !addVersionCodeToStoreTrack(publisher, edit, track, appId, appVersionCode, userFraction) {
-            return
+        if !completeStoreRelease(edit, track, appVersionCode) {
+            return false
         }
     } else {
 
         // Change the user fraction.
 
-        if !changeUserFraction(publisher, edit, track, appId, userFraction) {
-            return
+        if !changeUserFraction(edit, track, appVersionCode, userFraction) {
+            return false
         }
     }
 
-    _, err = publisher.Edits.
-            Commit(appId, edit.Id).
-            Do()
+    if !edit.commit() {
+        return false
+    }
+
+    postSlackMessage("Done.")
+    return true
+}
+
+func doScheduleRollout(
+        user string,
+        appId string,
+        appVersionCode int64,
+        storeTrack string,
+        userPercentages []int,
+        interval time.Duration) bool {
+    schedule, err := addSchedule(user, appId, appVersionCode, storeTrack, userPercentages, interval)
 
     if err != nil {
-        postSlackMessage("Sorry, I can't commit the edit: %v", err)
-        return
+        postSlackMessage("Sorry, I can't save the schedules: %v", err)
+        return false
     }
 
-    postSlackMessage("Done.")
+    auditSchedule(schedule, user, fmt.Sprintf(
+            "schedule rollout %v %v on %v %v every %v (schedule #%v)",
+            appId,
+            appVersionCode,
+            storeTrack,
+            strings.Trim(strings.Replace(fmt.Sprint(userPercentages), " ", ",", -1), "[]"),
+            interval,
+            schedule.Id))
+
+    postSlackMessage("Ok, that's schedule *#%v*.", schedule.Id)
+
+    // Start with the first step right away.
+
+    runSchedules()
+
+    return true
 }
 
-func doShowReleaseNotes(appId string, appVersionCode int64) {
-    postSlackMessage("Ok, showing release notes for *%v* with version code *%v* ...", appId, appVersionCode)
+func doSetReleaseNotes(
+        ctx context.Context,
+        appId string,
+        appVersionCode int64,
+        language string,
+        text string,
+        dryRun bool) bool {
+    postSlackMessage("Ok, setting release notes in *%v* for *%v* with version code *%v* ...", language, appId, appVersionCode)
+
+    releaseNotes := &androidpublisher.LocalizedText {
+        Language: language,
+        Text: text,
+    }
 
-    credentials := loadStoreCredentials()
+    if !validateReleaseNotes([]*androidpublisher.LocalizedText {releaseNotes}) {
+        return false
+    }
 
-    if credentials == nil {
-        return
+    edit := beginStoreEdit(ctx, appId, dryRun)
+
+    if edit == nil {
+        return false
     }
 
-    client := credentials.Client(oauth2.NoContext)
+    defer edit.close()
 
-    publisher, err := androidpublisher3.New(client)
+    track, release := findStoreRelease(edit.tracks, appVersionCode)
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't create the publisher: %v", err)
-        return
+    if release == nil {
+        postSlackMessage("Sorry, I can't find that version code.")
+        return false
     }
 
-    appId = fmt.Sprintf("%v.%v", getConfig("ANDROID_APP_ID_PREFIX"), appId)
+    recordJobTrack(ctx, track.Track)
 
-    edit, err := publisher.Edits.
-            Insert(appId, nil).
-            Do()
+    if !changeReleaseNotes(edit, track, appVersionCode, mergeReleaseNotes(release.ReleaseNotes, releaseNotes)) {
+        return false
+    }
+
+    if !edit.commit() {
+        return false
+    }
+
+    postSlackMessage("Done.")
+    return true
+}
+
+func doSetReleaseNotesFromFile(
+        ctx context.Context,
+        appId string,
+        appVersionCode int64,
+        fileName string,
+        fileUrl string,
+        dryRun bool) bool {
+    if len(fileUrl) == 0 {
+        postSlackMessage("Sorry, please attach a JSON or CSV file with the release notes.")
+        return false
+    }
+
+    postSlackMessage("Ok, setting release notes from *%v* for *%v* with version code *%v* ...", fileName, appId, appVersionCode)
+
+    data, err := downloadSlackFile(fileUrl)
 
     if err != nil {
-        postSlackMessage("Sorry, I can't insert the edit: %v", err)
-        return
+        postSlackMessage("Sorry, I can't download *%v*: %v", fileName, err)
+        return false
     }
 
-    tracks, err := publisher.Edits.Tracks.
-            List(appId, edit.Id).
-            Do()
+    var releaseNotes []*androidpublisher.LocalizedText
+
+    switch strings.ToLower(path.Ext(fileName)) {
+    case ".csv":
+        releaseNotes, err = parseReleaseNotesCsv(data)
+    case ".json":
+        releaseNotes, err = parseReleaseNotesJson(data)
+    default:
+        postSlackMessage("Sorry, I can only read release notes from JSON or CSV files.")
+        return false
+    }
 
     if err != nil {
-        postSlackMessage("Sorry, I can't list the tracks: %v", err)
-        return
+        postSlackMessage("Sorry, I can't parse the release notes: %v", err)
+        return false
     }
 
-    exists := false
+    if len(releaseNotes) == 0 {
+        postSlackMessage("Sorry, there are no release notes in *%v*.", fileName)
+        return false
+    }
 
-    for _, track := range tracks.Tracks {
-        for _, release := range track.Releases {
-            for _, candidate := range release.VersionCodes {
-                if candidate != appVersionCode {
-                    continue
-                }
+    if !validateReleaseNotes(releaseNotes) {
+        return false
+    }
 
-                exists = true
+    edit := beginStoreEdit(ctx, appId, dryRun)
 
-                for _, releaseNotes := range release.ReleaseNotes {
-                    postSlackMessage("*%v*: %v.", releaseNotes.Language, releaseNotes.Text)
-                }
-            }
-        }
+    if edit == nil {
+        return false
     }
 
-    if exists {
-        postSlackMessage("Done.")
-    } else {
+    defer edit.close()
+
+    track, release := findStoreRelease(edit.tracks, appVersionCode)
+
+    if release == nil {
         postSlackMessage("Sorry, I can't find that version code.")
+        return false
     }
+
+    recordJobTrack(ctx, track.Track)
+
+    if !changeReleaseNotes(edit, track, appVersionCode, releaseNotes) {
+        return false
+    }
+
+    if !edit.commit() {
+        return false
+    }
+
+    postSlackMessage("Done.")
+    return true
 }
 
-func doShowTracks(appId string) {
-    postSlackMessage("Ok, showing tracks for *%v* ...", appId)
+func doShare(ctx context.Context, artifactId string, version string) bool {
+    postSlackMessage("Ok, sharing *%v* with version *%v* ...", artifactId, version)
 
-    credentials := loadStoreCredentials()
+    version, artifactFormat, ok := resolveMavenArtifact(ctx, artifactId, version)
 
-    if credentials == nil {
-        return
+    if !ok {
+        return false
     }
 
-    client := credentials.Client(oauth2.NoContext)
+    // Only one APK can be shared, so split APKs share the first one.
 
-    publisher, err := androidpublisher2.New(client)
+    classifier := ""
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't create the publisher: %v", err)
-        return
+    if artifactFormat == "apk" {
+        classifier = findMavenArtifactClassifiers(artifactId)[0]
+    }
+
+    if len(classifier) > 0 {
+        postSlackMessage("Using the *%v* *%v* artifact.", classifier, artifactFormat)
+    } else {
+        postSlackMessage("Using the *%v* artifact.", artifactFormat)
     }
 
-    appId = fmt.Sprintf("%v.%v", getConfig("ANDROID_APP_ID_PREFIX"), appId)
+    artifactFile := downloadMavenArtifact(ctx, locateMavenArtifact(artifactId, version, classifier, artifactFormat))
 
-    edit, err := publisher.Edits.
-            Insert(appId, nil).
-            Do()
+    if artifactFile == nil {
+        return false
+    }
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't insert the edit: %v", err)
-        return
+    defer os.Remove(artifactFile.Name())
+    defer artifactFile.Close()
+
+    publisher := createStorePublisher(ctx)
+
+    if publisher == nil {
+        return false
     }
 
-    tracks, err := publisher.Edits.Tracks.
-            List(appId, edit.Id).
-            Do()
+    var artifact *androidpublisher.InternalAppSharingArtifact
+    var err error
+
+    if artifactFormat == "aab" {
+        artifact, err = publisher.shareBundle(getStoreAppId(artifactId), artifactFile)
+    } else {
+        artifact, err = publisher.shareApk(getStoreAppId(artifactId), artifactFile)
+    }
 
     if err != nil {
-        postSlackMessage("Sorry, I can't list the tracks: %v", err)
+        postSlackMessage("Sorry, I can't share the artifact: %v", err)
+        return false
+    }
+
+    postSlackMessage("Testers can install it from %v", artifact.DownloadUrl)
+    postSlackMessage("It's signed with the certificate *%v*.", artifact.CertificateFingerprint)
+
+    postSlackMessage("Done.")
+    return true
+}
+
+func doShowReleaseNotes(ctx context.Context, appId string, appVersionCode int64) bool {
+    postSlackMessage("Ok, showing release notes for *%v* with version code *%v* ...", appId, appVersionCode)
+
+    edit := beginStoreEdit(ctx, appId, false)
+
+    if edit == nil {
+        return false
+    }
+
+    defer edit.close()
+
+    _, release := findStoreRelease(edit.tracks, appVersionCode)
+
+    edit.discard()
+
+    if release == nil {
+        postSlackMessage("Sorry, I can't find that version code.")
+        return false
+    }
+
+    for _, releaseNotes := range release.ReleaseNotes {
+        postSlackMessage("*%v*: %v.", releaseNotes.Language, releaseNotes.Text)
+    }
+
+    postSlackMessage("Done.")
+    return true
+}
+
+func doShowSchedules() {
+    schedules := listSchedules()
+
+    if len(schedules) == 0 {
+        postSlackMessage("There are no schedules.")
         return
     }
 
-    for _, track := range tracks.Tracks {
-        if track.UserFraction == 0 {
-            postSlackMessage("Track *%v* contains version codes *%v*.", track.Track, track.VersionCodes)
-        } else {
-            postSlackMessage("Track *%v* contains version codes *%v* at *%v%%*.", track.Track, track.VersionCodes, track.UserFraction * 100)
+    for _, schedule := range schedules {
+        postSlackMessage("%v", formatSchedule(schedule))
+    }
+}
+
+func doShowTracks(ctx context.Context, appId string) bool {
+    postSlackMessage("Ok, showing tracks for *%v* ...", appId)
+
+    edit := beginStoreEdit(ctx, appId, false)
+
+    if edit == nil {
+        return false
+    }
+
+    defer edit.close()
+
+    for _, track := range edit.tracks {
+        if len(track.Releases) == 0 {
+            postSlackMessage("Track *%v* is empty.", track.Track)
+        }
+
+        for _, release := range track.Releases {
+            postSlackMessage("Track *%v* contains %v.", track.Track, formatStoreRelease(release))
         }
     }
 
+    edit.discard()
+
     postSlackMessage("Done.")
+    return true
+}
+
+func doStatus(jobId int) bool {
+    job := findJob(jobId)
+
+    if job == nil {
+        postSlackMessage("Sorry, I can't find job *#%v*.", jobId)
+        return false
+    }
+
+    postSlackMessage("%v", formatJob(job))
+    return true
+}
+
+func doSuggest(text string) {
+    similarCommand := findSimilarCommand(text)
+
+    if similarCommand == nil {
+        postSlackMessage("Sorry, I don't understand. Try `help`.")
+    } else {
+        postSlackMessage("Sorry, I don't understand. Did you mean %v? Try `help %v`.", similarCommand.getUsageText(), similarCommand.name)
+    }
 }
 
 func main() {
     log.Print("Starting up ...")
 
+    startJobWorkers()
+    startScheduler()
+
     handleSlackMessages()
 
     log.Print("Shutting down ...")
@@ -0,0 +1,733 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "fmt"
+    "google.golang.org/api/androidpublisher/v3"
+    "io/ioutil"
+    "log"
+    "os"
+    "path"
+    "strings"
+    "testing"
+)
+
+const testAppId = "com.example.app"
+
+// The directory of the audit log and the schedules of the tests.
+var testDirectory string
+
+func TestComplete(t *testing.T) {
+    tests := []struct {
+        name string
+        release *androidpublisher.TrackRelease
+        succeeded bool
+        expected string
+    }{
+        {
+            name: "completes an inProgress release",
+            release: newStoreRelease("1.0.0", 5, 0.5, nil),
+            succeeded: true,
+            expected: "production: 1.0.0 [5] completed",
+        },
+        {
+            name: "refuses a halted release",
+            release: newTestHaltedRelease("1.0.0", 5, 0.5),
+            expected: "production: 0.9.0 [4] completed, 1.0.0 [5] halted 0.5",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            publisher := startFakeStorePublisher(newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil), test.release))
+
+            succeeded := doComplete(context.Background(), "app", 5, false)
+
+            if succeeded != test.succeeded {
+                t.Errorf("expected %v, got %v", test.succeeded, succeeded)
+            }
+
+            actual := formatTestTracks(publisher.getTracks(testAppId))
+
+            if actual != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, actual)
+            }
+        })
+    }
+}
+
+func TestDeploy(t *testing.T) {
+    apk := newTestApk(testAppId, 101, "1.1.0")
+
+    tests := []struct {
+        name string
+        tracks []*androidpublisher.Track
+        classifiers string
+        files map[string][]byte
+        succeeded bool
+        expected string
+    }{
+        {
+            name: "replaces the internal track",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("internal", newStoreRelease("1.0.0", 5, 0, nil)),
+                newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil)),
+            },
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": newTestApk(testAppId, 101, "1.1.0"),
+            },
+            succeeded: true,
+            expected: "internal: 1.1.0 [101] completed; production: 0.9.0 [4] completed",
+        },
+        {
+            name: "prefers the app bundle",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.aab": newTestBundle(testAppId, 101, "1.1.0"),
+                "com/example/app/1.1.0/app-1.1.0.apk": []byte("not an APK"),
+            },
+            succeeded: true,
+            expected: "internal: 1.1.0 [101] completed",
+        },
+        {
+            name: "deploys without the release notes of an empty release notes artifact",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": newTestApk(testAppId, 101, "1.1.0"),
+                "com/example/app/1.1.0/app-1.1.0-release-notes.json": []byte("{}"),
+            },
+            succeeded: true,
+            expected: "internal: 1.1.0 [101] completed",
+        },
+        {
+            name: "refuses release notes in an unknown language",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": newTestApk(testAppId, 101, "1.1.0"),
+                "com/example/app/1.1.0/app-1.1.0-release-notes.json": []byte(`{"xx": "Fixes."}`),
+            },
+            expected: "",
+        },
+        {
+            name: "refuses the artifact of another app",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("internal", newStoreRelease("1.0.0", 5, 0, nil)),
+            },
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": newTestApk("com.example.other", 101, "1.1.0"),
+            },
+            expected: "internal: 1.0.0 [5] completed",
+        },
+        {
+            name: "refuses the artifact of another version",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": newTestApk(testAppId, 101, "1.0.0"),
+            },
+            expected: "",
+        },
+        {
+            name: "verifies the SHA-256 checksum",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": apk,
+                "com/example/app/1.1.0/app-1.1.0.apk.sha256": []byte(fmt.Sprintf("%x  app-1.1.0.apk\n", sha256.Sum256(apk))),
+            },
+            succeeded: true,
+            expected: "internal: 1.1.0 [101] completed",
+        },
+        {
+            name: "refuses a download with the wrong SHA-256 checksum",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": apk,
+                "com/example/app/1.1.0/app-1.1.0.apk.sha256": []byte(fmt.Sprintf("%x", sha256.Sum256(nil))),
+                "com/example/app/1.1.0/app-1.1.0.apk.sha1": []byte(fmt.Sprintf("%x", sha1.Sum(apk))),
+            },
+            expected: "",
+        },
+        {
+            name: "falls back to the SHA-1 checksum",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": apk,
+                "com/example/app/1.1.0/app-1.1.0.apk.sha1": []byte(fmt.Sprintf("%X", sha1.Sum(apk))),
+                "com/example/app/1.1.0/app-1.1.0.apk.md5": []byte(fmt.Sprintf("%x", md5.Sum(nil))),
+            },
+            succeeded: true,
+            expected: "internal: 1.1.0 [101] completed",
+        },
+        {
+            name: "refuses a download with the wrong SHA-1 checksum",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0.apk": apk,
+                "com/example/app/1.1.0/app-1.1.0.apk.sha1": []byte(fmt.Sprintf("%x", sha1.Sum(nil))),
+            },
+            expected: "",
+        },
+        {
+            name: "deploys split APKs",
+            classifiers: "arm,x86",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0-arm.apk": newTestApk(testAppId, 1101, "1.1.0"),
+                "com/example/app/1.1.0/app-1.1.0-x86.apk": newTestApk(testAppId, 2101, "1.1.0"),
+            },
+            succeeded: true,
+            expected: "internal: 1.1.0 [101 102] completed",
+        },
+        {
+            name: "refuses split APKs with the same version code",
+            classifiers: "arm,x86",
+            files: map[string][]byte {
+                "com/example/app/1.1.0/app-1.1.0-arm.apk": newTestApk(testAppId, 101, "1.1.0"),
+                "com/example/app/1.1.0/app-1.1.0-x86.apk": newTestApk(testAppId, 101, "1.1.0"),
+            },
+            expected: "",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            publisher := startFakeStorePublisher(test.tracks...)
+
+            repository := startFakeMavenRepository(test.files)
+            defer repository.Close()
+
+            os.Setenv("ANDROID_ARTIFACT_CLASSIFIERS_APP", test.classifiers)
+            defer os.Unsetenv("ANDROID_ARTIFACT_CLASSIFIERS_APP")
+
+            succeeded := doDeploy(context.Background(), "app", "1.1.0", false)
+
+            if succeeded != test.succeeded {
+                t.Errorf("expected %v, got %v", test.succeeded, succeeded)
+            }
+
+            // A refused artifact must not get as far as Play.
+
+            if !succeeded && publisher.lastVersionCode != 100 {
+                t.Errorf("expected no upload, got version code %v", publisher.lastVersionCode)
+            }
+
+            actual := formatTestTracks(publisher.getTracks(testAppId))
+
+            if actual != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, actual)
+            }
+        })
+    }
+}
+
+func TestHistory(t *testing.T) {
+    startTestAuditLog(t)
+
+    for index := 0; index <= maxListedAuditEntries; index++ {
+        err := appendAuditEntry(&auditEntry {
+            User: "U1",
+            Command: fmt.Sprintf("promote app %v to beta", index),
+            App: "app",
+            Outcome: jobStatusSucceeded,
+        })
+
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    var output bytes.Buffer
+
+    log.SetOutput(&output)
+    succeeded := doHistory("app", 1000)
+    log.SetOutput(os.Stderr)
+
+    if !succeeded {
+        t.Fatal("expected the history to be listed")
+    }
+
+    if !strings.Contains(output.String(), "I'm only listing the last 100 entries.") {
+        t.Errorf("expected the limit to be capped in %q", output.String())
+    }
+
+    if strings.Contains(output.String(), "`promote app 0 to beta`") ||
+            !strings.Contains(output.String(), "`promote app 1 to beta`") {
+        t.Errorf("expected the last 100 entries in %q", output.String())
+    }
+}
+
+func TestListVersions(t *testing.T) {
+    startTestAuditLog(t)
+
+    startFakeStorePublisher(
+            newTestTrack("internal", newStoreRelease("renamed", 101, 0, nil)),
+            newTestTrack("production", newStoreRelease("1.0.0", 4, 0, nil)))
+
+    // Only the deploy knows that the renamed release is 1.1.0.
+
+    err := appendAuditEntry(&auditEntry {
+        App: "app",
+        Version: "1.1.0",
+        VersionCode: 101,
+        Outcome: jobStatusSucceeded,
+    })
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var versions []string
+
+    for index := 1; index <= maxListedMavenVersions; index++ {
+        versions = append(versions, fmt.Sprintf("<version>0.0.%v</version>", index))
+    }
+
+    files := map[string][]byte {
+        "com/example/app/maven-metadata.xml": []byte(
+                "<metadata><versioning><versions>" + strings.Join(versions, "") +
+                "<version>1.0.0</version><version>1.1.0</version><version>1.2.0-SNAPSHOT</version>" +
+                "</versions><lastUpdated>20190501123000</lastUpdated></versioning></metadata>"),
+        "com/example/app/0.0.4/app-0.0.4.pom": nil,
+        "com/example/app/1.0.0/app-1.0.0.pom": nil,
+        "com/example/app/1.1.0/app-1.1.0.pom": nil,
+        "com/example/app/1.2.0-SNAPSHOT/maven-metadata.xml": nil,
+    }
+
+    repository := startFakeMavenRepository(files)
+    defer repository.Close()
+
+    var output bytes.Buffer
+
+    log.SetOutput(&output)
+    succeeded := doListVersions(context.Background(), "app", 100)
+    log.SetOutput(os.Stderr)
+
+    if !succeeded {
+        t.Fatal("expected the versions to be listed")
+    }
+
+    for _, expected := range []string {
+        "I'm only listing the newest 50 versions.",
+        "*1.2.0-SNAPSHOT* updated 2019-05-01 12:30\n",
+        "*1.1.0* updated 2019-05-01 12:30 on track *internal*\n",
+        "*1.0.0* updated 2019-05-01 12:30 on track *production*\n",
+        "*0.0.4* updated 2019-05-01 12:30\n",
+        "*0.0.5*\n",
+    } {
+        if !strings.Contains(output.String(), expected) {
+            t.Errorf("expected %q in %q", expected, output.String())
+        }
+    }
+
+    if strings.Contains(output.String(), "*0.0.3*") {
+        t.Errorf("expected at most %v versions in %q", maxListedMavenVersions, output.String())
+    }
+}
+
+func TestMain(m *testing.M) {
+    // Keep the audit log and the schedules of the tests out of the working directory.
+
+    var err error
+
+    testDirectory, err = ioutil.TempDir("", "android-release-bot")
+
+    if err != nil {
+        panic(err)
+    }
+
+    os.Setenv("ANDROID_APP_ID_PREFIX", "com.example")
+    os.Setenv("AUDIT_LOG_FILE", path.Join(testDirectory, "audit.log"))
+    os.Setenv("MAVEN_ACCOUNT_NAME", "bot")
+    os.Setenv("MAVEN_ACCOUNT_PASSWORD", "secret")
+    os.Setenv("MAVEN_GROUP_ID", "com.example")
+    os.Setenv("SCHEDULE_FILE", path.Join(testDirectory, "schedules.json"))
+
+    result := m.Run()
+
+    os.RemoveAll(testDirectory)
+    os.Exit(result)
+}
+
+func TestPromote(t *testing.T) {
+    tests := []struct {
+        name string
+        tracks []*androidpublisher.Track
+        storeTrack string
+        dryRun bool
+        succeeded bool
+        expected string
+    }{
+        {
+            name: "moves the version code to the track",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)),
+                newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil)),
+            },
+            storeTrack: "production",
+            succeeded: true,
+            expected: "beta:; production: 1.0.0 [5] completed",
+        },
+        {
+            name: "removes the version code from every other track",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("alpha", newStoreRelease("1.0.0", 5, 0, nil)),
+                newTestTrack("internal", newStoreRelease("1.0.0", 5, 0, nil)),
+            },
+            storeTrack: "beta",
+            succeeded: true,
+            expected: "alpha:; beta: 1.0.0 [5] completed; internal:",
+        },
+        {
+            name: "clears the target track",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)),
+                newTestTrack(
+                        "production",
+                        newStoreRelease("0.8.0", 3, 0, nil),
+                        newStoreRelease("0.9.0", 4, 0.2, nil)),
+            },
+            storeTrack: "production",
+            succeeded: true,
+            expected: "beta:; production: 1.0.0 [5] completed",
+        },
+        {
+            name: "moves split APKs together",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", &androidpublisher.TrackRelease {
+                    Name: "1.0.0",
+                    Status: storeReleaseStatusCompleted,
+                    VersionCodes: []int64 {5, 6},
+                }),
+            },
+            storeTrack: "production",
+            succeeded: true,
+            expected: "beta:; production: 1.0.0 [5 6] completed",
+        },
+        {
+            name: "refuses a version code that is already on the track",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("production", newStoreRelease("1.0.0", 5, 0, nil)),
+            },
+            storeTrack: "production",
+            expected: "production: 1.0.0 [5] completed",
+        },
+        {
+            name: "leaves the tracks alone in a dry run",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)),
+                newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil)),
+            },
+            storeTrack: "production",
+            dryRun: true,
+            succeeded: true,
+            expected: "beta: 1.0.0 [5] completed; production: 0.9.0 [4] completed",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            publisher := startFakeStorePublisher(test.tracks...)
+
+            succeeded := doPromote(context.Background(), "app", 5, test.storeTrack, test.dryRun)
+
+            if succeeded != test.succeeded {
+                t.Errorf("expected %v, got %v", test.succeeded, succeeded)
+            }
+
+            expectTestEditsClosed(t, publisher)
+
+            actual := formatTestTracks(publisher.getTracks(testAppId))
+
+            if actual != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, actual)
+            }
+        })
+    }
+}
+
+func TestRemove(t *testing.T) {
+    tests := []struct {
+        name string
+        tracks []*androidpublisher.Track
+        dryRun bool
+        expected string
+    }{
+        {
+            name: "drops releases left with no version codes",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)),
+                newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil)),
+            },
+            expected: "beta:; production: 0.9.0 [4] completed",
+        },
+        {
+            name: "removes the version code from every track",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("alpha", newStoreRelease("1.0.0", 5, 0, nil)),
+                newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil), newStoreRelease("1.0.0", 5, 0.1, nil)),
+            },
+            expected: "alpha:; production: 0.9.0 [4] completed",
+        },
+        {
+            name: "keeps the other split APKs of the release",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", &androidpublisher.TrackRelease {
+                    Name: "1.0.0",
+                    Status: storeReleaseStatusCompleted,
+                    VersionCodes: []int64 {5, 6},
+                }),
+            },
+            expected: "beta: 1.0.0 [6] completed",
+        },
+        {
+            name: "leaves the tracks alone in a dry run",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)),
+            },
+            dryRun: true,
+            expected: "beta: 1.0.0 [5] completed",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            publisher := startFakeStorePublisher(test.tracks...)
+
+            if !doRemove(context.Background(), "app", 5, test.dryRun) {
+                t.Error("expected the version code to be removed")
+            }
+
+            expectTestEditsClosed(t, publisher)
+
+            actual := formatTestTracks(publisher.getTracks(testAppId))
+
+            if actual != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, actual)
+            }
+        })
+    }
+}
+
+func TestResume(t *testing.T) {
+    tests := []struct {
+        name string
+        tracks []*androidpublisher.Track
+        succeeded bool
+        expected string
+    }{
+        {
+            name: "resumes a staged rollout at its user fraction",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil), newTestHaltedRelease("1.0.0", 5, 0.1)),
+            },
+            succeeded: true,
+            expected: "production: 0.9.0 [4] completed, 1.0.0 [5] inProgress 0.1",
+        },
+        {
+            name: "resumes a full release as completed",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", newTestHaltedRelease("1.0.0", 5, 0)),
+            },
+            succeeded: true,
+            expected: "beta: 1.0.0 [5] completed",
+        },
+        {
+            name: "refuses a release that isn't halted",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("production", newStoreRelease("1.0.0", 5, 0.1, nil)),
+            },
+            expected: "production: 1.0.0 [5] inProgress 0.1",
+        },
+        {
+            name: "refuses an unknown version code",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("production", newTestHaltedRelease("0.9.0", 4, 0.1)),
+            },
+            expected: "production: 0.9.0 [4] halted 0.1",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            publisher := startFakeStorePublisher(test.tracks...)
+
+            succeeded := doResume(context.Background(), "app", 5, false)
+
+            if succeeded != test.succeeded {
+                t.Errorf("expected %v, got %v", test.succeeded, succeeded)
+            }
+
+            expectTestEditsClosed(t, publisher)
+
+            actual := formatTestTracks(publisher.getTracks(testAppId))
+
+            if actual != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, actual)
+            }
+        })
+    }
+}
+
+func TestRollout(t *testing.T) {
+    tests := []struct {
+        name string
+        tracks []*androidpublisher.Track
+        storeTrack string
+        userPercentage int
+        dryRun bool
+        succeeded bool
+        expected string
+    }{
+        {
+            name: "creates an inProgress release",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)),
+                newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil)),
+            },
+            storeTrack: "production",
+            userPercentage: 10,
+            succeeded: true,
+            expected: "beta:; production: 1.0.0 [5] inProgress 0.1",
+        },
+        {
+            name: "updates the inProgress release",
+            tracks: []*androidpublisher.Track {
+                newTestTrack(
+                        "production",
+                        newStoreRelease("0.9.0", 4, 0, nil),
+                        newStoreRelease("1.0.0", 5, 0.1, nil)),
+            },
+            storeTrack: "production",
+            userPercentage: 50,
+            succeeded: true,
+            expected: "production: 0.9.0 [4] completed, 1.0.0 [5] inProgress 0.5",
+        },
+        {
+            name: "completes the inProgress release at 100%",
+            tracks: []*androidpublisher.Track {
+                newTestTrack(
+                        "production",
+                        newStoreRelease("0.9.0", 4, 0, nil),
+                        newStoreRelease("1.0.0", 5, 0.5, nil)),
+            },
+            storeTrack: "production",
+            userPercentage: 100,
+            succeeded: true,
+            expected: "production: 1.0.0 [5] completed",
+        },
+        {
+            name: "refuses a halted release",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("production", newTestHaltedRelease("1.0.0", 5, 0.1)),
+            },
+            storeTrack: "production",
+            userPercentage: 50,
+            expected: "production: 1.0.0 [5] halted 0.1",
+        },
+        {
+            name: "refuses a completed release",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("beta", newStoreRelease("1.0.0", 5, 0, nil)),
+            },
+            storeTrack: "beta",
+            userPercentage: 10,
+            expected: "beta: 1.0.0 [5] completed",
+        },
+        {
+            name: "leaves the tracks alone in a dry run",
+            tracks: []*androidpublisher.Track {
+                newTestTrack("production", newStoreRelease("0.9.0", 4, 0, nil), newStoreRelease("1.0.0", 5, 0.1, nil)),
+            },
+            storeTrack: "production",
+            userPercentage: 50,
+            dryRun: true,
+            succeeded: true,
+            expected: "production: 0.9.0 [4] completed, 1.0.0 [5] inProgress 0.1",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            publisher := startFakeStorePublisher(test.tracks...)
+
+            succeeded := doRollout(context.Background(), "app", 5, test.storeTrack, test.userPercentage, test.dryRun)
+
+            if succeeded != test.succeeded {
+                t.Errorf("expected %v, got %v", test.succeeded, succeeded)
+            }
+
+            expectTestEditsClosed(t, publisher)
+
+            actual := formatTestTracks(publisher.getTracks(testAppId))
+
+            if actual != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, actual)
+            }
+        })
+    }
+}
+
+// Every edit must be committed or deleted, whatever happened.
+func expectTestEditsClosed(t *testing.T, publisher *fakeStorePublisher) {
+    if len(publisher.edits) > 0 {
+        t.Errorf("expected no open edits, got %v", len(publisher.edits))
+    }
+}
+
+// Describes the tracks in one line, e.g. "beta: 1.0.0 [5] completed; production:".
+func formatTestTracks(tracks []*androidpublisher.Track) string {
+    var result []string
+
+    for _, track := range tracks {
+        var releases []string
+
+        for _, release := range track.Releases {
+            var versionCodes []string
+
+            for _, versionCode := range release.VersionCodes {
+                versionCodes = append(versionCodes, fmt.Sprint(versionCode))
+            }
+
+            text := fmt.Sprintf("%v [%v] %v", release.Name, strings.Join(versionCodes, " "), release.Status)
+
+            if release.UserFraction > 0 {
+                text += fmt.Sprintf(" %v", release.UserFraction)
+            }
+
+            releases = append(releases, text)
+        }
+
+        if len(releases) == 0 {
+            result = append(result, track.Track + ":")
+        } else {
+            result = append(result, track.Track + ": " + strings.Join(releases, ", "))
+        }
+    }
+
+    return strings.Join(result, "; ")
+}
+
+func newTestHaltedRelease(name string, appVersionCode int64, userFraction float64) *androidpublisher.TrackRelease {
+    release := newStoreRelease(name, appVersionCode, userFraction, nil)
+    release.Status = storeReleaseStatusHalted
+
+    return release
+}
+
+func newTestTrack(storeTrack string, releases ...*androidpublisher.TrackRelease) *androidpublisher.Track {
+    return &androidpublisher.Track {
+        Track: storeTrack,
+        Releases: releases,
+    }
+}
+
+// Replaces the Google publisher with a fake that has the tracks of the test app.
+func startFakeStorePublisher(tracks ...*androidpublisher.Track) *fakeStorePublisher {
+    publisher := newFakeStorePublisher()
+    publisher.setTracks(testAppId, tracks...)
+
+    createStorePublisher = func(ctx context.Context) storePublisher {
+        return publisher
+    }
+
+    return publisher
+}
+
+// Gives the test an audit log of its own.
+func startTestAuditLog(t *testing.T) {
+    os.Setenv("AUDIT_LOG_FILE", path.Join(testDirectory, strings.Replace(t.Name(), "/", "-", -1) + ".log"))
+}
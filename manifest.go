@@ -0,0 +1,582 @@
+package main
+
+import (
+    "archive/zip"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "strconv"
+    "unicode/utf16"
+)
+
+// What Play checks in the manifest of an artifact.
+type androidManifest struct {
+    packageName string
+    versionCode int64
+    versionName string
+    minSdkVersion int
+    targetSdkVersion int
+}
+
+// An element of the manifest, whether it comes from the binary XML of an APK or the protocol buffer of a bundle.
+type androidManifestElement struct {
+    name string
+    attributes []*androidManifestAttribute
+}
+
+type androidManifestAttribute struct {
+    name string
+    resourceId uint32
+    value string
+
+    // Whether the value refers to a resource, e.g. @string/version_name, which only Play resolves.
+    reference bool
+}
+
+// The chunk types of binary XML files.
+const (
+    binaryXmlTypeStringPool = 0x0001
+    binaryXmlTypeXml = 0x0003
+    binaryXmlTypeStartElement = 0x0102
+    binaryXmlTypeResourceMap = 0x0180
+)
+
+// The value types of binary XML attributes.
+const (
+    binaryXmlValueReference = 0x01
+    binaryXmlValueAttribute = 0x02
+    binaryXmlValueString = 0x03
+    binaryXmlValueIntDecimal = 0x10
+    binaryXmlValueIntHexadecimal = 0x11
+)
+
+// The resource IDs of the android: attributes, which are what counts when the names are stripped.
+const (
+    androidResourceMinSdkVersion = 0x0101020c
+    androidResourceTargetSdkVersion = 0x01010270
+    androidResourceVersionCode = 0x0101021b
+    androidResourceVersionName = 0x0101021c
+)
+
+// Refuses artifacts that are for another app or another version than the one being deployed.
+func checkAndroidManifest(manifest *androidManifest, appId string, version string) bool {
+    postSlackMessage(
+            "The artifact is *%v* with version name *%v*, version code *%v* and SDK versions *%v* to *%v*.",
+            manifest.packageName,
+            manifest.versionName,
+            manifest.versionCode,
+            manifest.minSdkVersion,
+            manifest.targetSdkVersion)
+
+    valid := true
+
+    if manifest.packageName != appId {
+        postSlackMessage("Sorry, the artifact is for *%v*, not for *%v*.", manifest.packageName, appId)
+        valid = false
+    }
+
+    // SNAPSHOT builds carry the SNAPSHOT version, not the one of the build.
+
+    if manifest.versionName != version && manifest.versionName != getMavenBaseVersion(version) {
+        postSlackMessage("Sorry, the artifact has version name *%v*, not *%v*.", manifest.versionName, getMavenBaseVersion(version))
+        valid = false
+    }
+
+    return valid
+}
+
+func getBinaryXmlString(strings []string, index uint32) string {
+    if int(index) >= len(strings) {
+        return ""
+    }
+
+    return strings[index]
+}
+
+func parseBinaryXmlElement(chunk []byte, headerSize int, strings []string, resourceIds []uint32) (*androidManifestElement, error) {
+    if len(chunk) < headerSize + 20 {
+        return nil, errors.New("truncated element")
+    }
+
+    extension := chunk[headerSize:]
+
+    element := &androidManifestElement {
+        name: getBinaryXmlString(strings, binary.LittleEndian.Uint32(extension[4:])),
+    }
+
+    attributeStart := int(binary.LittleEndian.Uint16(extension[8:]))
+    attributeSize := int(binary.LittleEndian.Uint16(extension[10:]))
+    attributeCount := int(binary.LittleEndian.Uint16(extension[12:]))
+
+    if attributeSize < 20 || len(extension) < attributeStart + attributeSize * attributeCount {
+        return nil, errors.New("truncated attributes")
+    }
+
+    for index := 0; index < attributeCount; index++ {
+        data := extension[attributeStart + index * attributeSize:]
+
+        nameIndex := binary.LittleEndian.Uint32(data[4:])
+        rawValue := binary.LittleEndian.Uint32(data[8:])
+        valueType := data[15]
+        value := binary.LittleEndian.Uint32(data[16:])
+
+        attribute := &androidManifestAttribute {
+            name: getBinaryXmlString(strings, nameIndex),
+        }
+
+        if int(nameIndex) < len(resourceIds) {
+            attribute.resourceId = resourceIds[nameIndex]
+        }
+
+        switch {
+        case valueType == binaryXmlValueReference || valueType == binaryXmlValueAttribute:
+            attribute.reference = true
+        case valueType == binaryXmlValueString:
+            attribute.value = getBinaryXmlString(strings, value)
+        case valueType == binaryXmlValueIntDecimal || valueType == binaryXmlValueIntHexadecimal:
+            attribute.value = strconv.FormatInt(int64(int32(value)), 10)
+        default:
+            attribute.value = getBinaryXmlString(strings, rawValue)
+        }
+
+        element.attributes = append(element.attributes, attribute)
+    }
+
+    return element, nil
+}
+
+// Reads the compiled AndroidManifest.xml of an APK.
+func parseBinaryXmlManifest(data []byte) (*androidManifest, error) {
+    if len(data) < 8 || binary.LittleEndian.Uint16(data) != binaryXmlTypeXml {
+        return nil, errors.New("not a binary XML file")
+    }
+
+    if int(binary.LittleEndian.Uint32(data[4:])) > len(data) {
+        return nil, errors.New("truncated binary XML file")
+    }
+
+    var strings []string
+    var resourceIds []uint32
+
+    result := &androidManifest {}
+
+    for offset := int(binary.LittleEndian.Uint16(data[2:])); offset + 8 <= len(data); {
+        chunkType := binary.LittleEndian.Uint16(data[offset:])
+        headerSize := int(binary.LittleEndian.Uint16(data[offset + 2:]))
+        chunkSize := int(binary.LittleEndian.Uint32(data[offset + 4:]))
+
+        if chunkSize < 8 || headerSize > chunkSize || offset + chunkSize > len(data) {
+            return nil, errors.New("truncated chunk")
+        }
+
+        chunk := data[offset:offset + chunkSize]
+
+        switch chunkType {
+        case binaryXmlTypeStringPool:
+            var err error
+
+            strings, err = parseBinaryXmlStringPool(chunk)
+
+            if err != nil {
+                return nil, err
+            }
+        case binaryXmlTypeResourceMap:
+            for index := headerSize; index + 4 <= len(chunk); index += 4 {
+                resourceIds = append(resourceIds, binary.LittleEndian.Uint32(chunk[index:]))
+            }
+        case binaryXmlTypeStartElement:
+            element, err := parseBinaryXmlElement(chunk, headerSize, strings, resourceIds)
+
+            if err != nil {
+                return nil, err
+            }
+
+            err = result.addElement(element)
+
+            if err != nil {
+                return nil, err
+            }
+        }
+
+        offset += chunkSize
+    }
+
+    return result, nil
+}
+
+func parseBinaryXmlStringPool(chunk []byte) ([]string, error) {
+    if len(chunk) < 28 {
+        return nil, errors.New("truncated string pool")
+    }
+
+    headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+    stringCount := int(binary.LittleEndian.Uint32(chunk[8:]))
+    utf8 := binary.LittleEndian.Uint32(chunk[16:]) & 0x100 != 0
+    stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+
+    if len(chunk) < headerSize + stringCount * 4 || stringsStart > len(chunk) {
+        return nil, errors.New("truncated string pool")
+    }
+
+    var result []string
+
+    for index := 0; index < stringCount; index++ {
+        offset := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize + index * 4:]))
+
+        if offset >= len(chunk) {
+            return nil, errors.New("truncated string")
+        }
+
+        var value string
+        var err error
+
+        if utf8 {
+            value, err = readBinaryXmlUtf8String(chunk[offset:])
+        } else {
+            value, err = readBinaryXmlUtf16String(chunk[offset:])
+        }
+
+        if err != nil {
+            return nil, err
+        }
+
+        result = append(result, value)
+    }
+
+    return result, nil
+}
+
+// Reads the manifest of the base module of an app bundle, stored as an aapt2 XmlNode protocol buffer.
+func parseProtoXmlManifest(data []byte) (*androidManifest, error) {
+    result := &androidManifest {}
+
+    err := readProtoXmlNode(data, result)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return result, nil
+}
+
+func readAndroidManifest(file *os.File, artifactFormat string) (*androidManifest, error) {
+    info, err := file.Stat()
+
+    if err != nil {
+        return nil, err
+    }
+
+    reader, err := zip.NewReader(file, info.Size())
+
+    if err != nil {
+        return nil, err
+    }
+
+    name := "AndroidManifest.xml"
+
+    if artifactFormat == "aab" {
+        name = "base/manifest/AndroidManifest.xml"
+    }
+
+    for _, entry := range reader.File {
+        if entry.Name != name {
+            continue
+        }
+
+        entryReader, err := entry.Open()
+
+        if err != nil {
+            return nil, err
+        }
+
+        data, err := ioutil.ReadAll(entryReader)
+
+        entryReader.Close()
+
+        if err != nil {
+            return nil, err
+        }
+
+        if artifactFormat == "aab" {
+            return parseProtoXmlManifest(data)
+        }
+
+        return parseBinaryXmlManifest(data)
+    }
+
+    return nil, fmt.Errorf("there's no %v", name)
+}
+
+func readBinaryXmlUtf16String(data []byte) (string, error) {
+    if len(data) < 2 {
+        return "", errors.New("truncated string")
+    }
+
+    length := int(binary.LittleEndian.Uint16(data))
+    data = data[2:]
+
+    if length & 0x8000 != 0 {
+        if len(data) < 2 {
+            return "", errors.New("truncated string")
+        }
+
+        length = (length & 0x7fff) << 16 | int(binary.LittleEndian.Uint16(data))
+        data = data[2:]
+    }
+
+    if len(data) < length * 2 {
+        return "", errors.New("truncated string")
+    }
+
+    units := make([]uint16, length)
+
+    for index := range units {
+        units[index] = binary.LittleEndian.Uint16(data[index * 2:])
+    }
+
+    return string(utf16.Decode(units)), nil
+}
+
+func readBinaryXmlUtf8Length(data []byte) (int, []byte, error) {
+    if len(data) < 1 {
+        return 0, nil, errors.New("truncated string")
+    }
+
+    length := int(data[0])
+
+    if length & 0x80 == 0 {
+        return length, data[1:], nil
+    }
+
+    if len(data) < 2 {
+        return 0, nil, errors.New("truncated string")
+    }
+
+    return (length & 0x7f) << 8 | int(data[1]), data[2:], nil
+}
+
+// Reads the length in UTF-16 units, then the length in bytes and the bytes.
+func readBinaryXmlUtf8String(data []byte) (string, error) {
+    _, data, err := readBinaryXmlUtf8Length(data)
+
+    if err != nil {
+        return "", err
+    }
+
+    length, data, err := readBinaryXmlUtf8Length(data)
+
+    if err != nil {
+        return "", err
+    }
+
+    if len(data) < length {
+        return "", errors.New("truncated string")
+    }
+
+    return string(data[:length]), nil
+}
+
+// Calls the visitor for every field of a protocol buffer message,
+// with the value of varint fields or the bytes of length-delimited fields.
+func readProtoFields(data []byte, visit func(field int, value uint64, bytes []byte) error) error {
+    for len(data) > 0 {
+        key, size := binary.Uvarint(data)
+
+        if size <= 0 {
+            return errors.New("invalid protocol buffer")
+        }
+
+        data = data[size:]
+
+        var err error
+
+        switch key & 7 {
+        case 0:
+            value, size := binary.Uvarint(data)
+
+            if size <= 0 {
+                return errors.New("invalid protocol buffer")
+            }
+
+            data = data[size:]
+            err = visit(int(key >> 3), value, nil)
+        case 1:
+            if len(data) < 8 {
+                return errors.New("invalid protocol buffer")
+            }
+
+            data = data[8:]
+        case 2:
+            length, size := binary.Uvarint(data)
+
+            if size <= 0 || length > uint64(len(data) - size) {
+                return errors.New("invalid protocol buffer")
+            }
+
+            err = visit(int(key >> 3), 0, data[size:size + int(length)])
+            data = data[size + int(length):]
+        case 5:
+            if len(data) < 4 {
+                return errors.New("invalid protocol buffer")
+            }
+
+            data = data[4:]
+        default:
+            return errors.New("invalid protocol buffer")
+        }
+
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Reads an XmlAttribute, whose value is either plain text or a compiled item.
+func readProtoXmlAttribute(data []byte) (*androidManifestAttribute, error) {
+    result := &androidManifestAttribute {}
+
+    err := readProtoFields(data, func(field int, value uint64, bytes []byte) error {
+        switch field {
+        case 2:
+            result.name = string(bytes)
+        case 3:
+            result.value = string(bytes)
+        case 5:
+            result.resourceId = uint32(value)
+        case 6:
+
+            // An Item with a Reference (1), a String (2) or a Primitive (7) with a decimal (6) or hexadecimal (7) int.
+
+            return readProtoFields(bytes, func(field int, value uint64, bytes []byte) error {
+                switch field {
+                case 1:
+                    result.reference = true
+                case 2:
+                    return readProtoFields(bytes, func(field int, value uint64, bytes []byte) error {
+                        if field == 1 {
+                            result.value = string(bytes)
+                        }
+
+                        return nil
+                    })
+                case 7:
+                    return readProtoFields(bytes, func(field int, value uint64, bytes []byte) error {
+                        if field == 6 || field == 7 {
+                            result.value = strconv.FormatInt(int64(int32(value)), 10)
+                        }
+
+                        return nil
+                    })
+                }
+
+                return nil
+            })
+        }
+
+        return nil
+    })
+
+    return result, err
+}
+
+// Reads an XmlNode, whose element (1) has a name (3), attributes (4) and child nodes (5).
+func readProtoXmlNode(data []byte, manifest *androidManifest) error {
+    return readProtoFields(data, func(field int, value uint64, bytes []byte) error {
+        if field != 1 {
+            return nil
+        }
+
+        element := &androidManifestElement {}
+
+        var children [][]byte
+
+        err := readProtoFields(bytes, func(field int, value uint64, bytes []byte) error {
+            switch field {
+            case 3:
+                element.name = string(bytes)
+            case 4:
+                attribute, err := readProtoXmlAttribute(bytes)
+
+                if err != nil {
+                    return err
+                }
+
+                element.attributes = append(element.attributes, attribute)
+            case 5:
+                children = append(children, bytes)
+            }
+
+            return nil
+        })
+
+        if err != nil {
+            return err
+        }
+
+        err = manifest.addElement(element)
+
+        if err != nil {
+            return err
+        }
+
+        for _, child := range children {
+            err = readProtoXmlNode(child, manifest)
+
+            if err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+}
+
+func (manifest *androidManifest) addElement(element *androidManifestElement) error {
+    for _, attribute := range element.attributes {
+        var field interface{}
+
+        switch {
+        case element.name == "manifest" && attribute.name == "package":
+            field = &manifest.packageName
+        case element.name == "manifest" && attribute.is("versionCode", androidResourceVersionCode):
+            field = &manifest.versionCode
+        case element.name == "manifest" && attribute.is("versionName", androidResourceVersionName):
+            field = &manifest.versionName
+        case element.name == "uses-sdk" && attribute.is("minSdkVersion", androidResourceMinSdkVersion):
+            field = &manifest.minSdkVersion
+        case element.name == "uses-sdk" && attribute.is("targetSdkVersion", androidResourceTargetSdkVersion):
+            field = &manifest.targetSdkVersion
+        default:
+            continue
+        }
+
+        if attribute.reference {
+            return fmt.Errorf("can't check %v in %v, the value is a resource reference", attribute.name, element.name)
+        }
+
+        var err error
+
+        switch field := field.(type) {
+        case *int:
+            *field, err = strconv.Atoi(attribute.value)
+        case *int64:
+            *field, err = strconv.ParseInt(attribute.value, 0, 64)
+        case *string:
+            *field = attribute.value
+        }
+
+        if err != nil {
+            return fmt.Errorf("invalid %v in %v: %v", attribute.name, element.name, err)
+        }
+    }
+
+    return nil
+}
+
+func (attribute *androidManifestAttribute) is(name string, resourceId uint32) bool {
+    return attribute.resourceId == resourceId || (attribute.resourceId == 0 && attribute.name == name)
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/binary"
+    "io/ioutil"
+    "os"
+    "strings"
+    "testing"
+    "unicode/utf16"
+)
+
+// An element to compile into a binary XML or protocol buffer manifest for the tests.
+type testManifestElement struct {
+    name string
+    attributes []*testManifestAttribute
+}
+
+// An attribute with a string, an integer or a reference value of the given binary XML type.
+type testManifestAttribute struct {
+    name string
+    resourceId uint32
+    valueType uint8
+    value uint32
+    text string
+}
+
+func TestCheckAndroidManifest(t *testing.T) {
+    tests := []struct {
+        name string
+        packageName string
+        versionName string
+        version string
+        valid bool
+    }{
+        {
+            name: "accepts the version",
+            packageName: testAppId,
+            versionName: "1.1.0",
+            version: "1.1.0",
+            valid: true,
+        },
+        {
+            name: "accepts the SNAPSHOT version of a SNAPSHOT build",
+            packageName: testAppId,
+            versionName: "1.2.0-SNAPSHOT",
+            version: "1.2.0-20190501.123000-3",
+            valid: true,
+        },
+        {
+            name: "refuses another version",
+            packageName: testAppId,
+            versionName: "1.0.0",
+            version: "1.1.0",
+        },
+        {
+            name: "refuses another SNAPSHOT version",
+            packageName: testAppId,
+            versionName: "1.1.0-SNAPSHOT",
+            version: "1.2.0-20190501.123000-3",
+        },
+        {
+            name: "refuses another app",
+            packageName: "com.example.other",
+            versionName: "1.1.0",
+            version: "1.1.0",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            manifest := &androidManifest {packageName: test.packageName, versionCode: 101, versionName: test.versionName}
+
+            valid := checkAndroidManifest(manifest, testAppId, test.version)
+
+            if valid != test.valid {
+                t.Errorf("expected %v, got %v", test.valid, valid)
+            }
+        })
+    }
+}
+
+func TestParseBinaryXmlManifest(t *testing.T) {
+    data := readTestManifest(t)
+
+    manifest, err := parseBinaryXmlManifest(data)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The icon and the theme are references, which only matter for the attributes Play checks.
+
+    expectTestManifest(t, manifest, "com.zentus.balloon", 42, "")
+
+    // Every cut must be noticed, wherever it falls.
+
+    for length := 0; length < len(data); length++ {
+        _, err := parseBinaryXmlManifest(data[:length])
+
+        if err == nil {
+            t.Fatalf("expected an error for the first %v bytes", length)
+        }
+    }
+
+    // Garbage must not crash the bot.
+
+    for index := range data {
+        corruptData := append([]byte {}, data...)
+        corruptData[index] ^= 0xff
+
+        parseBinaryXmlManifest(corruptData)
+    }
+}
+
+func TestParseProtoXmlManifest(t *testing.T) {
+    data := compileProtoXmlManifest(newTestManifestElements(testAppId, 101, "1.1.0"))
+
+    manifest, err := parseProtoXmlManifest(data)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expectTestManifest(t, manifest, testAppId, 101, "1.1.0")
+
+    for length := 1; length < len(data); length++ {
+        _, err := parseProtoXmlManifest(data[:length])
+
+        if err == nil {
+            t.Fatalf("expected an error for the first %v bytes", length)
+        }
+    }
+
+    for index := range data {
+        corruptData := append([]byte {}, data...)
+        corruptData[index] ^= 0xff
+
+        parseProtoXmlManifest(corruptData)
+    }
+}
+
+func TestReadAndroidManifest(t *testing.T) {
+    referenceElements := newTestManifestElements(testAppId, 101, "")
+    referenceElements[0].attributes[1] = &testManifestAttribute {
+        name: "versionName",
+        resourceId: androidResourceVersionName,
+        valueType: binaryXmlValueReference,
+        value: 0x7f0e0001,
+        text: "@string/version_name",
+    }
+
+    tests := []struct {
+        name string
+        data []byte
+        artifactFormat string
+        expectedError string
+        expectedVersionCode int64
+    }{
+        {
+            name: "APK built by aapt",
+            data: newTestZip(map[string][]byte {"AndroidManifest.xml": readTestManifest(t)}),
+            artifactFormat: "apk",
+            expectedVersionCode: 42,
+        },
+        {
+            name: "app bundle",
+            data: newTestBundle(testAppId, 101, "1.1.0"),
+            artifactFormat: "aab",
+            expectedVersionCode: 101,
+        },
+        {
+            name: "APK with a version name reference",
+            data: newTestZip(map[string][]byte {"AndroidManifest.xml": compileBinaryXmlManifest(referenceElements)}),
+            artifactFormat: "apk",
+            expectedError: "can't check versionName in manifest, the value is a resource reference",
+        },
+        {
+            name: "app bundle with a version name reference",
+            data: newTestZip(map[string][]byte {
+                "base/manifest/AndroidManifest.xml": compileProtoXmlManifest(referenceElements),
+            }),
+            artifactFormat: "aab",
+            expectedError: "can't check versionName in manifest, the value is a resource reference",
+        },
+        {
+            name: "app bundle without a manifest",
+            data: newTestApk(testAppId, 101, "1.1.0"),
+            artifactFormat: "aab",
+            expectedError: "there's no base/manifest/AndroidManifest.xml",
+        },
+        {
+            name: "truncated APK",
+            data: newTestApk(testAppId, 101, "1.1.0")[:100],
+            artifactFormat: "apk",
+            expectedError: "zip: not a valid zip file",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            file := writeTestArtifact(t, test.data)
+
+            defer os.Remove(file.Name())
+            defer file.Close()
+
+            manifest, err := readAndroidManifest(file, test.artifactFormat)
+
+            if len(test.expectedError) > 0 {
+                if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+                    t.Fatalf("expected %q, got %v", test.expectedError, err)
+                }
+
+                return
+            }
+
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            if manifest.versionCode != test.expectedVersionCode {
+                t.Errorf("expected %v, got %v", test.expectedVersionCode, manifest.versionCode)
+            }
+        })
+    }
+}
+
+func expectTestManifest(t *testing.T, manifest *androidManifest, packageName string, versionCode int64, versionName string) {
+    if manifest.packageName != packageName || manifest.versionCode != versionCode || manifest.versionName != versionName {
+        t.Errorf(
+                "expected %v %v %v, got %v %v %v",
+                packageName,
+                versionCode,
+                versionName,
+                manifest.packageName,
+                manifest.versionCode,
+                manifest.versionName)
+    }
+}
+
+func newTestApk(packageName string, versionCode int64, versionName string) []byte {
+    return newTestZip(map[string][]byte {
+        "AndroidManifest.xml": compileBinaryXmlManifest(newTestManifestElements(packageName, versionCode, versionName)),
+    })
+}
+
+func newTestBundle(packageName string, versionCode int64, versionName string) []byte {
+    return newTestZip(map[string][]byte {
+        "base/manifest/AndroidManifest.xml": compileProtoXmlManifest(newTestManifestElements(packageName, versionCode, versionName)),
+    })
+}
+
+// The manifest and uses-sdk elements the way aapt compiles them.
+func newTestManifestElements(packageName string, versionCode int64, versionName string) []*testManifestElement {
+    return []*testManifestElement {
+        {
+            name: "manifest",
+            attributes: []*testManifestAttribute {
+                {name: "versionCode", resourceId: androidResourceVersionCode, valueType: binaryXmlValueIntDecimal, value: uint32(versionCode)},
+                {name: "versionName", resourceId: androidResourceVersionName, valueType: binaryXmlValueString, text: versionName},
+                {name: "package", valueType: binaryXmlValueString, text: packageName},
+            },
+        },
+        {
+            name: "uses-sdk",
+            attributes: []*testManifestAttribute {
+                {name: "minSdkVersion", resourceId: androidResourceMinSdkVersion, valueType: binaryXmlValueIntDecimal, value: 21},
+                {name: "targetSdkVersion", resourceId: androidResourceTargetSdkVersion, valueType: binaryXmlValueIntDecimal, value: 28},
+            },
+        },
+    }
+}
+
+func newTestZip(files map[string][]byte) []byte {
+    var result bytes.Buffer
+
+    writer := zip.NewWriter(&result)
+
+    for name, data := range files {
+        fileWriter, err := writer.Create(name)
+
+        if err != nil {
+            panic(err)
+        }
+
+        fileWriter.Write(data)
+    }
+
+    err := writer.Close()
+
+    if err != nil {
+        panic(err)
+    }
+
+    return result.Bytes()
+}
+
+// Compiles the elements like aapt: the string pool starts with the attribute names that have a resource ID,
+// followed by the resource map and a start element chunk for every element.
+func compileBinaryXmlManifest(elements []*testManifestElement) []byte {
+    var poolStrings []string
+    var resourceIds []uint32
+
+    stringIndexes := map[string]uint32 {}
+
+    addString := func(value string) uint32 {
+        index, exists := stringIndexes[value]
+
+        if !exists {
+            index = uint32(len(poolStrings))
+            stringIndexes[value] = index
+            poolStrings = append(poolStrings, value)
+        }
+
+        return index
+    }
+
+    for _, element := range elements {
+        for _, attribute := range element.attributes {
+            if attribute.resourceId != 0 {
+                addString(attribute.name)
+                resourceIds = append(resourceIds, attribute.resourceId)
+            }
+        }
+    }
+
+    var body bytes.Buffer
+
+    for _, element := range elements {
+        var chunk bytes.Buffer
+
+        writeTestUint32(&chunk, 0xffffffff)
+        writeTestUint32(&chunk, addString(element.name))
+        writeTestUint16(&chunk, 20)
+        writeTestUint16(&chunk, 20)
+        writeTestUint16(&chunk, uint16(len(element.attributes)))
+        writeTestUint16(&chunk, 0)
+        writeTestUint16(&chunk, 0)
+        writeTestUint16(&chunk, 0)
+
+        for _, attribute := range element.attributes {
+            rawValue := uint32(0xffffffff)
+            value := attribute.value
+
+            if attribute.valueType == binaryXmlValueString {
+                value = addString(attribute.text)
+                rawValue = value
+            }
+
+            writeTestUint32(&chunk, 0xffffffff)
+            writeTestUint32(&chunk, addString(attribute.name))
+            writeTestUint32(&chunk, rawValue)
+            writeTestUint16(&chunk, 8)
+            chunk.WriteByte(0)
+            chunk.WriteByte(attribute.valueType)
+            writeTestUint32(&chunk, value)
+        }
+
+        writeTestChunk(&body, binaryXmlTypeStartElement, []byte {1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}, chunk.Bytes())
+    }
+
+    var stringData bytes.Buffer
+    var stringOffsets bytes.Buffer
+
+    for _, value := range poolStrings {
+        writeTestUint32(&stringOffsets, uint32(stringData.Len()))
+
+        units := utf16.Encode([]rune(value))
+
+        writeTestUint16(&stringData, uint16(len(units)))
+
+        for _, unit := range units {
+            writeTestUint16(&stringData, unit)
+        }
+
+        writeTestUint16(&stringData, 0)
+    }
+
+    for stringData.Len() % 4 != 0 {
+        stringData.WriteByte(0)
+    }
+
+    var stringPoolHeader bytes.Buffer
+
+    writeTestUint32(&stringPoolHeader, uint32(len(poolStrings)))
+    writeTestUint32(&stringPoolHeader, 0)
+    writeTestUint32(&stringPoolHeader, 0)
+    writeTestUint32(&stringPoolHeader, uint32(28 + stringOffsets.Len()))
+    writeTestUint32(&stringPoolHeader, 0)
+
+    var resourceMap bytes.Buffer
+
+    for _, resourceId := range resourceIds {
+        writeTestUint32(&resourceMap, resourceId)
+    }
+
+    var chunks bytes.Buffer
+
+    writeTestChunk(&chunks, binaryXmlTypeStringPool, stringPoolHeader.Bytes(), append(stringOffsets.Bytes(), stringData.Bytes()...))
+    writeTestChunk(&chunks, binaryXmlTypeResourceMap, nil, resourceMap.Bytes())
+    chunks.Write(body.Bytes())
+
+    var result bytes.Buffer
+
+    writeTestChunk(&result, binaryXmlTypeXml, nil, chunks.Bytes())
+
+    return result.Bytes()
+}
+
+// Compiles the elements like aapt2 into nested XmlNode messages,
+// with the text of string attributes and a compiled Primitive for integers.
+func compileProtoXmlManifest(elements []*testManifestElement) []byte {
+    var child []byte
+
+    for index := len(elements) - 1; index >= 0; index-- {
+        element := elements[index]
+
+        var message bytes.Buffer
+
+        writeTestProtoBytes(&message, 3, []byte(element.name))
+
+        for _, attribute := range element.attributes {
+            var attributeMessage bytes.Buffer
+
+            writeTestProtoBytes(&attributeMessage, 1, []byte("http://schemas.android.com/apk/res/android"))
+            writeTestProtoBytes(&attributeMessage, 2, []byte(attribute.name))
+
+            if attribute.valueType == binaryXmlValueString || attribute.valueType == binaryXmlValueReference {
+                writeTestProtoBytes(&attributeMessage, 3, []byte(attribute.text))
+            }
+
+            if attribute.resourceId != 0 {
+                writeTestProtoVarint(&attributeMessage, 5, uint64(attribute.resourceId))
+            }
+
+            if attribute.valueType == binaryXmlValueIntDecimal {
+                var primitive bytes.Buffer
+                var item bytes.Buffer
+
+                writeTestProtoVarint(&primitive, 6, uint64(attribute.value))
+                writeTestProtoBytes(&item, 7, primitive.Bytes())
+                writeTestProtoBytes(&attributeMessage, 6, item.Bytes())
+            }
+
+            if attribute.valueType == binaryXmlValueReference {
+                var reference bytes.Buffer
+                var item bytes.Buffer
+
+                writeTestProtoVarint(&reference, 2, uint64(attribute.value))
+                writeTestProtoBytes(&reference, 3, []byte(strings.TrimPrefix(attribute.text, "@")))
+                writeTestProtoBytes(&item, 1, reference.Bytes())
+                writeTestProtoBytes(&attributeMessage, 6, item.Bytes())
+            }
+
+            writeTestProtoBytes(&message, 4, attributeMessage.Bytes())
+        }
+
+        if child != nil {
+            writeTestProtoBytes(&message, 5, child)
+        }
+
+        var node bytes.Buffer
+
+        writeTestProtoBytes(&node, 1, message.Bytes())
+
+        child = node.Bytes()
+    }
+
+    return child
+}
+
+// The AndroidManifest.xml of an APK built by aapt, from the tests of golang.org/x/mobile (BSD license).
+func readTestManifest(t *testing.T) []byte {
+    data, err := ioutil.ReadFile("testdata/AndroidManifest.xml")
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return data
+}
+
+// Writes the artifact to a temporary file, which the caller removes.
+func writeTestArtifact(t *testing.T, data []byte) *os.File {
+    file, err := ioutil.TempFile(testDirectory, "artifact")
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = file.Write(data)
+
+    if err != nil {
+        file.Close()
+        os.Remove(file.Name())
+        t.Fatal(err)
+    }
+
+    return file
+}
+
+func writeTestChunk(buffer *bytes.Buffer, chunkType uint16, header []byte, body []byte) {
+    writeTestUint16(buffer, chunkType)
+    writeTestUint16(buffer, uint16(8 + len(header)))
+    writeTestUint32(buffer, uint32(8 + len(header) + len(body)))
+    buffer.Write(header)
+    buffer.Write(body)
+}
+
+func writeTestProtoBytes(buffer *bytes.Buffer, field int, value []byte) {
+    writeTestProtoKey(buffer, field, 2)
+    writeTestProtoUvarint(buffer, uint64(len(value)))
+    buffer.Write(value)
+}
+
+func writeTestProtoKey(buffer *bytes.Buffer, field int, wireType int) {
+    writeTestProtoUvarint(buffer, uint64(field << 3 | wireType))
+}
+
+func writeTestProtoUvarint(buffer *bytes.Buffer, value uint64) {
+    data := make([]byte, binary.MaxVarintLen64)
+    buffer.Write(data[:binary.PutUvarint(data, value)])
+}
+
+func writeTestProtoVarint(buffer *bytes.Buffer, field int, value uint64) {
+    writeTestProtoKey(buffer, field, 0)
+    writeTestProtoUvarint(buffer, value)
+}
+
+func writeTestUint16(buffer *bytes.Buffer, value uint16) {
+    binary.Write(buffer, binary.LittleEndian, value)
+}
+
+func writeTestUint32(buffer *bytes.Buffer, value uint32) {
+    binary.Write(buffer, binary.LittleEndian, value)
+}
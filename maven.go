@@ -1,15 +1,90 @@
 package main
 
 import (
+    "context"
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/xml"
+    "fmt"
+    "hash"
     "io"
     "io/ioutil"
     "net/http"
     "net/url"
     "os"
+    "path"
+    "regexp"
     "strings"
+    "time"
 )
 
-func downloadMavenArtifact(url string) *os.File {
+// A checksum file that Maven publishes next to every file, e.g. app-1.2.3.aab.sha256.
+type mavenChecksum struct {
+    extension string
+    description string
+    newHash func() hash.Hash
+}
+
+// The maven-metadata.xml of an artifact or of one of its SNAPSHOT versions.
+type mavenMetadata struct {
+    Versioning mavenMetadataVersioning `xml:"versioning"`
+}
+
+type mavenMetadataVersioning struct {
+    Latest string `xml:"latest"`
+    Release string `xml:"release"`
+    Versions []string `xml:"versions>version"`
+    LastUpdated string `xml:"lastUpdated"`
+    Snapshot mavenMetadataSnapshot `xml:"snapshot"`
+}
+
+// The newest build of a SNAPSHOT version, e.g. 1.3.0-20200102.030405-6.
+type mavenMetadataSnapshot struct {
+    Timestamp string `xml:"timestamp"`
+    BuildNumber int `xml:"buildNumber"`
+}
+
+// The most versions 'list versions' shows, since every one costs a request to the repository.
+const maxListedMavenVersions = 50
+
+// How many requests to the repository run at the same time.
+const mavenRequestConcurrency = 8
+
+// How times of the repository are shown.
+const mavenTimeLayout = "2006-01-02 15:04"
+
+// The checksums in order of preference.
+var mavenChecksums = []*mavenChecksum {
+    {
+        extension: "sha256",
+        description: "SHA-256",
+        newHash: sha256.New,
+    },
+    {
+        extension: "sha1",
+        description: "SHA-1",
+        newHash: sha1.New,
+    },
+    {
+        extension: "md5",
+        description: "MD5",
+        newHash: md5.New,
+    },
+}
+
+// Matches the versions of SNAPSHOT builds, whose files live in the directory of the SNAPSHOT version.
+var mavenSnapshotBuildExpression = regexp.MustCompile("^(.+)-[0-9]{8}\\.[0-9]{6}-[0-9]+$")
+
+// Downloads the file and verifies it with the best checksum the repository has for it.
+func downloadMavenArtifact(ctx context.Context, url string) *os.File {
+    checksum, expectedValue, ok := loadMavenChecksum(ctx, url)
+
+    if !ok {
+        return nil
+    }
+
     client := &http.Client{}
 
     request, err := http.NewRequest("GET", url, nil)
@@ -19,6 +94,8 @@ func downloadMavenArtifact(url string) *os.File {
         return nil
     }
 
+    request = request.WithContext(ctx)
+
     request.SetBasicAuth(getConfig("MAVEN_ACCOUNT_NAME"), getConfig("MAVEN_ACCOUNT_PASSWORD"))
 
     response, err := client.Do(request)
@@ -42,16 +119,50 @@ func downloadMavenArtifact(url string) *os.File {
         return nil
     }
 
-    _, err = io.Copy(result, response.Body)
+    var digest hash.Hash
+
+    if checksum != nil {
+        digest = checksum.newHash()
+        _, err = io.Copy(io.MultiWriter(result, digest), response.Body)
+    } else {
+        _, err = io.Copy(result, response.Body)
+    }
 
     if err != nil {
+        result.Close()
+        os.Remove(result.Name())
+
         postSlackMessage("Sorry, I can't write the temporary file: %v", err)
         return nil
     }
 
+    if checksum == nil {
+        postSlackMessage("There's no checksum for *%v*, so I can't verify the download.", path.Base(url))
+    } else {
+        value := hex.EncodeToString(digest.Sum(nil))
+
+        if value != expectedValue {
+            result.Close()
+            os.Remove(result.Name())
+
+            postSlackMessage(
+                    "Sorry, the %v checksum of *%v* is *%v*, but the repository says *%v*.",
+                    checksum.description,
+                    path.Base(url),
+                    value,
+                    expectedValue)
+            return nil
+        }
+
+        postSlackMessage("Verified *%v* with the %v checksum *%v*.", path.Base(url), checksum.description, value)
+    }
+
     _, err = result.Seek(0, 0)
 
     if err != nil {
+        result.Close()
+        os.Remove(result.Name())
+
         postSlackMessage("Sorry, I can't seek in the temporary file: %v", err)
         return nil
     }
@@ -59,20 +170,340 @@ func downloadMavenArtifact(url string) *os.File {
     return result
 }
 
-func locateMavenArtifact(artifactId string, version string) string {
-    var result strings.Builder
+func existsMavenArtifact(ctx context.Context, url string) bool {
+    client := &http.Client{}
+
+    request, err := http.NewRequest("HEAD", url, nil)
+
+    if err != nil {
+        return false
+    }
+
+    request = request.WithContext(ctx)
+    request.SetBasicAuth(getConfig("MAVEN_ACCOUNT_NAME"), getConfig("MAVEN_ACCOUNT_PASSWORD"))
 
-    artifactId = url.PathEscape(artifactId)
-    version = url.PathEscape(version)
+    response, err := client.Do(request)
+
+    if err != nil {
+        return false
+    }
+
+    response.Body.Close()
+
+    return response.StatusCode == 200
+}
+
+// Reads the classifiers of the split APKs of an app, e.g. ANDROID_ARTIFACT_CLASSIFIERS_MY_APP=arm64-v8a,armeabi-v7a.
+// Returns the empty classifier for apps with a single artifact.
+func findMavenArtifactClassifiers(artifactId string) []string {
+    var result []string
+
+    for _, classifier := range strings.Split(getOptionalAppConfig("ANDROID_ARTIFACT_CLASSIFIERS", artifactId, ""), ",") {
+        classifier = strings.TrimSpace(classifier)
+
+        if len(classifier) > 0 {
+            result = append(result, classifier)
+        }
+    }
+
+    if len(result) == 0 {
+        return []string {""}
+    }
+
+    return result
+}
+
+// Prefers app bundles, unless the app config forces a format or has split APKs.
+func findMavenArtifactFormat(ctx context.Context, artifactId string, version string) string {
+    format := getOptionalAppConfig("ANDROID_ARTIFACT_FORMAT", artifactId, "")
+
+    if len(format) > 0 {
+        return format
+    }
+
+    if len(getOptionalAppConfig("ANDROID_ARTIFACT_CLASSIFIERS", artifactId, "")) > 0 {
+        return "apk"
+    }
+
+    if existsMavenArtifact(ctx, locateMavenArtifact(artifactId, version, "", "aab")) {
+        return "aab"
+    }
+
+    return "apk"
+}
+
+// Turns a lastUpdated value like 20200102030405 into the format of the history.
+func formatMavenTimestamp(timestamp string) string {
+    value, err := time.Parse("20060102150405", timestamp)
+
+    if err != nil {
+        return timestamp
+    }
+
+    return value.Format(mavenTimeLayout)
+}
+
+// Returns the SNAPSHOT version of a SNAPSHOT build, and any other version as it is.
+func getMavenBaseVersion(version string) string {
+    values := mavenSnapshotBuildExpression.FindStringSubmatch(version)
+
+    if values == nil {
+        return version
+    }
+
+    return values[1] + "-SNAPSHOT"
+}
+
+// Returns the first checksum the repository has for the file, or nil if there is none.
+// Returns false if the repository can't be asked.
+func loadMavenChecksum(ctx context.Context, url string) (*mavenChecksum, string, bool) {
+    client := &http.Client{}
+
+    for _, checksum := range mavenChecksums {
+        request, err := http.NewRequest("GET", url + "." + checksum.extension, nil)
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't create the HTTP request: %v", err)
+            return nil, "", false
+        }
+
+        request = request.WithContext(ctx)
+        request.SetBasicAuth(getConfig("MAVEN_ACCOUNT_NAME"), getConfig("MAVEN_ACCOUNT_PASSWORD"))
+
+        response, err := client.Do(request)
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't execute the HTTP request: %v", err)
+            return nil, "", false
+        }
+
+        if response.StatusCode == 404 {
+            response.Body.Close()
+            continue
+        }
+
+        if response.StatusCode != 200 {
+            response.Body.Close()
+            postSlackMessage("Sorry, I didn't expect that HTTP status code: %v", response.StatusCode)
+            return nil, "", false
+        }
+
+        data, err := ioutil.ReadAll(response.Body)
+
+        response.Body.Close()
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't read the %v checksum: %v", checksum.description, err)
+            return nil, "", false
+        }
+
+        // Some repositories append the file name to the value.
+
+        fields := strings.Fields(string(data))
+
+        if len(fields) == 0 {
+            postSlackMessage("Sorry, the %v checksum of *%v* is empty.", checksum.description, path.Base(url))
+            return nil, "", false
+        }
+
+        return checksum, strings.ToLower(fields[0]), true
+    }
+
+    return nil, "", true
+}
+
+// Asks the repository when the version was uploaded, which is when its pom was, or for a SNAPSHOT version,
+// when its maven-metadata.xml was. Other than SNAPSHOTs, releases have no maven-metadata.xml of their own.
+// Returns the zero time if the repository doesn't say.
+func loadMavenLastModified(ctx context.Context, artifactId string, version string) time.Time {
+    client := &http.Client{}
+
+    url := locateMavenArtifact(artifactId, version, "", "pom")
+
+    if strings.HasSuffix(version, "-SNAPSHOT") {
+        url = locateMavenDirectory(artifactId, version) + "maven-metadata.xml"
+    }
+
+    request, err := http.NewRequest("HEAD", url, nil)
+
+    if err != nil {
+        return time.Time {}
+    }
+
+    request = request.WithContext(ctx)
+    request.SetBasicAuth(getConfig("MAVEN_ACCOUNT_NAME"), getConfig("MAVEN_ACCOUNT_PASSWORD"))
+
+    response, err := client.Do(request)
+
+    if err != nil {
+        return time.Time {}
+    }
+
+    response.Body.Close()
+
+    if response.StatusCode != 200 {
+        return time.Time {}
+    }
+
+    result, err := http.ParseTime(response.Header.Get("Last-Modified"))
+
+    if err != nil {
+        return time.Time {}
+    }
+
+    return result
+}
+
+// Loads the maven-metadata.xml of the version, or of the artifact if the version is empty.
+// Returns nil if there is none and false if the repository can't be asked.
+func loadMavenMetadata(ctx context.Context, artifactId string, version string) (*mavenMetadata, bool) {
+    client := &http.Client{}
+
+    request, err := http.NewRequest("GET", locateMavenDirectory(artifactId, version) + "maven-metadata.xml", nil)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't create the HTTP request: %v", err)
+        return nil, false
+    }
+
+    request = request.WithContext(ctx)
+    request.SetBasicAuth(getConfig("MAVEN_ACCOUNT_NAME"), getConfig("MAVEN_ACCOUNT_PASSWORD"))
+
+    response, err := client.Do(request)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't execute the HTTP request: %v", err)
+        return nil, false
+    }
+
+    defer response.Body.Close()
+
+    if response.StatusCode == 404 {
+        return nil, true
+    }
+
+    if response.StatusCode != 200 {
+        postSlackMessage("Sorry, I didn't expect that HTTP status code: %v", response.StatusCode)
+        return nil, false
+    }
+
+    var result mavenMetadata
+
+    err = xml.NewDecoder(response.Body).Decode(&result)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't parse the Maven metadata: %v", err)
+        return nil, false
+    }
+
+    return &result, true
+}
+
+func locateMavenArtifact(artifactId string, version string, classifier string, extension string) string {
+    if len(classifier) > 0 {
+        classifier = "-" + url.PathEscape(classifier)
+    }
+
+    return locateMavenDirectory(artifactId, getMavenBaseVersion(version)) +
+            url.PathEscape(artifactId) + "-" + url.PathEscape(version) + classifier + "." + extension
+}
+
+// Returns the directory of the version, or of the artifact if the version is empty.
+func locateMavenDirectory(artifactId string, version string) string {
+    var result strings.Builder
 
     result.WriteString(getConfig("MAVEN_REPOSITORY"))
     result.WriteString(strings.Replace(getConfig("MAVEN_GROUP_ID"), ".", "/", -1))
     result.WriteString("/")
-    result.WriteString(artifactId)
+    result.WriteString(url.PathEscape(artifactId))
     result.WriteString("/")
-    result.WriteString(version)
-    result.WriteString("/")
-    result.WriteString(artifactId + "-" + version + ".apk")
+
+    if len(version) > 0 {
+        result.WriteString(url.PathEscape(version))
+        result.WriteString("/")
+    }
 
     return result.String()
 }
+
+// Resolves the version of the artifact to deploy or share, and finds its format. The job remembers the resolved
+// version, so the history shows which build was used.
+func resolveMavenArtifact(ctx context.Context, artifactId string, version string) (string, string, bool) {
+    version, ok := resolveMavenVersion(ctx, artifactId, version)
+
+    if !ok {
+        return "", "", false
+    }
+
+    recordJobVersion(ctx, version)
+
+    artifactFormat := findMavenArtifactFormat(ctx, artifactId, version)
+
+    if artifactFormat != "aab" && artifactFormat != "apk" {
+        postSlackMessage("Sorry, I don't know the artifact format *%v*.", artifactFormat)
+        return "", "", false
+    }
+
+    return version, artifactFormat, true
+}
+
+// Turns latest, release and SNAPSHOT versions into the version of a concrete build.
+func resolveMavenVersion(ctx context.Context, artifactId string, version string) (string, bool) {
+    result := version
+
+    if version == "latest" || version == "release" {
+        metadata, ok := loadMavenMetadata(ctx, artifactId, "")
+
+        if !ok {
+            return "", false
+        }
+
+        if metadata == nil {
+            postSlackMessage("Sorry, I can't find the Maven metadata of *%v*.", artifactId)
+            return "", false
+        }
+
+        if version == "latest" {
+            result = metadata.Versioning.Latest
+
+            if len(result) == 0 && len(metadata.Versioning.Versions) > 0 {
+                result = metadata.Versioning.Versions[len(metadata.Versioning.Versions) - 1]
+            }
+        } else {
+            result = metadata.Versioning.Release
+        }
+
+        if len(result) == 0 {
+            postSlackMessage("Sorry, the Maven metadata of *%v* has no %v version.", artifactId, version)
+            return "", false
+        }
+    }
+
+    if strings.HasSuffix(result, "-SNAPSHOT") {
+        metadata, ok := loadMavenMetadata(ctx, artifactId, result)
+
+        if !ok {
+            return "", false
+        }
+
+        if metadata == nil {
+            postSlackMessage("Sorry, I can't find the Maven metadata of *%v*.", artifactId)
+            return "", false
+        }
+
+        snapshot := metadata.Versioning.Snapshot
+
+        if len(snapshot.Timestamp) == 0 {
+            postSlackMessage("Sorry, there's no build of *%v* with version *%v*.", artifactId, result)
+            return "", false
+        }
+
+        result = fmt.Sprintf("%v-%v-%v", strings.TrimSuffix(result, "-SNAPSHOT"), snapshot.Timestamp, snapshot.BuildNumber)
+    }
+
+    if result != version {
+        postSlackMessage("Resolved *%v* to version *%v*.", version, result)
+    }
+
+    return result, true
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+// When the files of the fake repository were uploaded.
+var testMavenUploadTime = time.Date(2019, 5, 1, 12, 30, 0, 0, time.UTC)
+
+func TestDownloadMavenArtifactCancelled(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        if !strings.HasSuffix(request.URL.Path, ".apk") {
+            http.NotFound(writer, request)
+            return
+        }
+
+        // Send half of the artifact, then hang until the job gets cancelled.
+
+        writer.Header().Set("Content-Length", "2048")
+        writer.Write(make([]byte, 1024))
+        writer.(http.Flusher).Flush()
+
+        <-request.Context().Done()
+    }))
+
+    defer server.Close()
+
+    temporaryDirectory, err := ioutil.TempDir(testDirectory, "tmp")
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    savedTemporaryDirectory := os.Getenv("TMPDIR")
+    defer os.Setenv("TMPDIR", savedTemporaryDirectory)
+
+    os.Setenv("TMPDIR", temporaryDirectory)
+
+    // Cancel as soon as the download is being written.
+
+    go func() {
+        for ctx.Err() == nil {
+            files, _ := ioutil.ReadDir(temporaryDirectory)
+
+            if len(files) > 0 {
+                cancel()
+                return
+            }
+
+            time.Sleep(time.Millisecond)
+        }
+    }()
+
+    if downloadMavenArtifact(ctx, server.URL + "/app-1.0.0.apk") != nil {
+        t.Fatal("expected the download to fail")
+    }
+
+    files, err := ioutil.ReadDir(temporaryDirectory)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(files) > 0 {
+        t.Errorf("expected the partial download to be removed, got %v", files[0].Name())
+    }
+}
+
+func TestResolveMavenVersion(t *testing.T) {
+    artifactMetadata := []byte(
+            "<metadata><versioning><latest>1.2.0-SNAPSHOT</latest><release>1.1.0</release>" +
+            "<versions><version>1.0.0</version><version>1.1.0</version><version>1.2.0-SNAPSHOT</version></versions>" +
+            "</versioning></metadata>")
+    snapshotMetadata := []byte(
+            "<metadata><versioning><snapshot><timestamp>20190501.123000</timestamp><buildNumber>3</buildNumber></snapshot>" +
+            "</versioning></metadata>")
+
+    tests := []struct {
+        name string
+        files map[string][]byte
+        version string
+        ok bool
+        expected string
+    }{
+        {
+            name: "keeps a release version",
+            version: "1.0.0",
+            ok: true,
+            expected: "1.0.0",
+        },
+        {
+            name: "resolves the release version",
+            files: map[string][]byte {"com/example/app/maven-metadata.xml": artifactMetadata},
+            version: "release",
+            ok: true,
+            expected: "1.1.0",
+        },
+        {
+            name: "resolves the latest version to its newest build",
+            files: map[string][]byte {
+                "com/example/app/maven-metadata.xml": artifactMetadata,
+                "com/example/app/1.2.0-SNAPSHOT/maven-metadata.xml": snapshotMetadata,
+            },
+            version: "latest",
+            ok: true,
+            expected: "1.2.0-20190501.123000-3",
+        },
+        {
+            name: "falls back to the last version without a latest version",
+            files: map[string][]byte {
+                "com/example/app/maven-metadata.xml": []byte(
+                        "<metadata><versioning><versions><version>1.0.0</version></versions></versioning></metadata>"),
+            },
+            version: "latest",
+            ok: true,
+            expected: "1.0.0",
+        },
+        {
+            name: "resolves a SNAPSHOT version to its newest build",
+            files: map[string][]byte {"com/example/app/1.2.0-SNAPSHOT/maven-metadata.xml": snapshotMetadata},
+            version: "1.2.0-SNAPSHOT",
+            ok: true,
+            expected: "1.2.0-20190501.123000-3",
+        },
+        {
+            name: "refuses the release version without a release",
+            files: map[string][]byte {
+                "com/example/app/maven-metadata.xml": []byte("<metadata><versioning></versioning></metadata>"),
+            },
+            version: "release",
+        },
+        {
+            name: "refuses the latest version without metadata",
+            version: "latest",
+        },
+        {
+            name: "refuses a SNAPSHOT version without metadata",
+            version: "1.2.0-SNAPSHOT",
+        },
+        {
+            name: "refuses a SNAPSHOT version without builds",
+            files: map[string][]byte {
+                "com/example/app/1.2.0-SNAPSHOT/maven-metadata.xml": []byte("<metadata><versioning></versioning></metadata>"),
+            },
+            version: "1.2.0-SNAPSHOT",
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            repository := startFakeMavenRepository(test.files)
+            defer repository.Close()
+
+            actual, ok := resolveMavenVersion(context.Background(), "app", test.version)
+
+            if ok != test.ok || actual != test.expected {
+                t.Errorf("expected %q %v, got %q %v", test.expected, test.ok, actual, ok)
+            }
+        })
+    }
+}
+
+// Serves the files at their paths in the repository, e.g. com/example/app/1.0.0/app-1.0.0.apk,
+// and points the config at it.
+func startFakeMavenRepository(files map[string][]byte) *httptest.Server {
+    server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+        name := strings.TrimPrefix(request.URL.Path, "/repository/")
+        data, exists := files[name]
+
+        if !exists {
+            http.NotFound(writer, request)
+            return
+        }
+
+        http.ServeContent(writer, request, name, testMavenUploadTime, bytes.NewReader(data))
+    }))
+
+    os.Setenv("MAVEN_REPOSITORY", server.URL + "/repository/")
+
+    return server
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+    "archive/zip"
+    "bytes"
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "google.golang.org/api/androidpublisher/v3"
+    "io/ioutil"
+    "os"
+    "path"
+    "sort"
+    "strings"
+    "unicode/utf8"
+)
+
+// Play rejects release notes that are longer than that many characters.
+const maxReleaseNotesLength = 500
+
+// The languages Play accepts for release notes.
+var releaseNotesLanguages = map[string]bool {
+    "af": true, "am": true, "ar": true, "az-AZ": true, "be": true, "bg": true, "bn-BD": true, "ca": true,
+    "cs-CZ": true, "da-DK": true, "de-DE": true, "el-GR": true, "en-AU": true, "en-CA": true, "en-GB": true,
+    "en-IN": true, "en-SG": true, "en-US": true, "en-ZA": true, "es-419": true, "es-ES": true, "es-US": true,
+    "et": true, "eu-ES": true, "fa": true, "fa-AE": true, "fa-AF": true, "fa-IR": true, "fi-FI": true,
+    "fil": true, "fr-CA": true, "fr-FR": true, "gl-ES": true, "gu": true, "hi-IN": true, "hr": true,
+    "hu-HU": true, "hy-AM": true, "id": true, "is-IS": true, "it-IT": true, "iw-IL": true, "ja-JP": true,
+    "ka-GE": true, "kk": true, "km-KH": true, "kn-IN": true, "ko-KR": true, "ky-KG": true, "lo-LA": true,
+    "lt": true, "lv": true, "mk-MK": true, "ml-IN": true, "mn-MN": true, "mr-IN": true, "ms": true,
+    "ms-MY": true, "my-MM": true, "ne-NP": true, "nl-NL": true, "no-NO": true, "pa": true, "pl-PL": true,
+    "pt-BR": true, "pt-PT": true, "rm": true, "ro": true, "ru-RU": true, "si-LK": true, "sk": true,
+    "sl": true, "sq": true, "sr": true, "sv-SE": true, "sw": true, "ta-IN": true, "te-IN": true, "th": true,
+    "tr-TR": true, "uk": true, "ur": true, "vi": true, "zh-CN": true, "zh-HK": true, "zh-TW": true, "zu": true,
+}
+
+// Looks for a JSON object of texts by language or a zip with one <language>.txt per language next to the artifact.
+// Returns false if the release notes exist but can't be used, and no release notes if there are none.
+func loadMavenReleaseNotes(ctx context.Context, artifactId string, version string) ([]*androidpublisher.LocalizedText, bool) {
+    var releaseNotes []*androidpublisher.LocalizedText
+
+    jsonUrl := locateMavenArtifact(artifactId, version, "release-notes", "json")
+    zipUrl := locateMavenArtifact(artifactId, version, "release-notes", "zip")
+
+    switch {
+    case existsMavenArtifact(ctx, jsonUrl):
+        file := downloadMavenArtifact(ctx, jsonUrl)
+
+        if file == nil {
+            return nil, false
+        }
+
+        defer os.Remove(file.Name())
+        defer file.Close()
+
+        data, err := ioutil.ReadAll(file)
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't read the release notes: %v", err)
+            return nil, false
+        }
+
+        releaseNotes, err = parseReleaseNotesJson(data)
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't parse the release notes: %v", err)
+            return nil, false
+        }
+    case existsMavenArtifact(ctx, zipUrl):
+        file := downloadMavenArtifact(ctx, zipUrl)
+
+        if file == nil {
+            return nil, false
+        }
+
+        defer os.Remove(file.Name())
+        defer file.Close()
+
+        var err error
+
+        releaseNotes, err = parseReleaseNotesZip(file)
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't read the release notes: %v", err)
+            return nil, false
+        }
+    default:
+        postSlackMessage("There are no release notes for version *%v*.", version)
+        return nil, true
+    }
+
+    if len(releaseNotes) == 0 {
+        postSlackMessage("The release notes artifact of version *%v* is empty, so I'm not attaching any.", version)
+        return releaseNotes, true
+    }
+
+    if !validateReleaseNotes(releaseNotes) {
+        return nil, false
+    }
+
+    var languages []string
+
+    for _, text := range releaseNotes {
+        languages = append(languages, "*" + text.Language + "*")
+    }
+
+    postSlackMessage("Attaching the release notes in %v.", strings.Join(languages, ", "))
+
+    return releaseNotes, true
+}
+
+// Replaces the release notes in the language of the text or adds them.
+func mergeReleaseNotes(
+        releaseNotes []*androidpublisher.LocalizedText,
+        text *androidpublisher.LocalizedText) []*androidpublisher.LocalizedText {
+    result := []*androidpublisher.LocalizedText {text}
+
+    for _, candidate := range releaseNotes {
+        if candidate.Language != text.Language {
+            result = append(result, candidate)
+        }
+    }
+
+    sortReleaseNotes(result)
+
+    return result
+}
+
+// Expects one language and text per row, optionally below a "language,text" header.
+func parseReleaseNotesCsv(data []byte) ([]*androidpublisher.LocalizedText, error) {
+    reader := csv.NewReader(bytes.NewReader(data))
+    reader.FieldsPerRecord = 2
+
+    records, err := reader.ReadAll()
+
+    if err != nil {
+        return nil, err
+    }
+
+    result := []*androidpublisher.LocalizedText {}
+
+    for index, record := range records {
+        if index == 0 && strings.EqualFold(record[0], "language") {
+            continue
+        }
+
+        result = append(result, &androidpublisher.LocalizedText {
+            Language: strings.TrimSpace(record[0]),
+            Text: strings.TrimSpace(record[1]),
+        })
+    }
+
+    sortReleaseNotes(result)
+
+    return result, nil
+}
+
+func parseReleaseNotesJson(data []byte) ([]*androidpublisher.LocalizedText, error) {
+    var texts map[string]string
+
+    err := json.Unmarshal(data, &texts)
+
+    if err != nil {
+        return nil, err
+    }
+
+    result := []*androidpublisher.LocalizedText {}
+
+    for language, text := range texts {
+        result = append(result, &androidpublisher.LocalizedText {
+            Language: language,
+            Text: strings.TrimSpace(text),
+        })
+    }
+
+    sortReleaseNotes(result)
+
+    return result, nil
+}
+
+func parseReleaseNotesZip(file *os.File) ([]*androidpublisher.LocalizedText, error) {
+    info, err := file.Stat()
+
+    if err != nil {
+        return nil, err
+    }
+
+    reader, err := zip.NewReader(file, info.Size())
+
+    if err != nil {
+        return nil, err
+    }
+
+    result := []*androidpublisher.LocalizedText {}
+
+    for _, entry := range reader.File {
+        if entry.FileInfo().IsDir() {
+            continue
+        }
+
+        entryReader, err := entry.Open()
+
+        if err != nil {
+            return nil, fmt.Errorf("%v: %v", entry.Name, err)
+        }
+
+        data, err := ioutil.ReadAll(entryReader)
+
+        entryReader.Close()
+
+        if err != nil {
+            return nil, fmt.Errorf("%v: %v", entry.Name, err)
+        }
+
+        result = append(result, &androidpublisher.LocalizedText {
+            Language: strings.TrimSuffix(path.Base(entry.Name), path.Ext(entry.Name)),
+            Text: strings.TrimSpace(string(data)),
+        })
+    }
+
+    sortReleaseNotes(result)
+
+    return result, nil
+}
+
+func sortReleaseNotes(releaseNotes []*androidpublisher.LocalizedText) {
+    sort.Slice(releaseNotes, func(left int, right int) bool {
+        return releaseNotes[left].Language < releaseNotes[right].Language
+    })
+}
+
+func validateReleaseNotes(releaseNotes []*androidpublisher.LocalizedText) bool {
+    valid := true
+
+    for _, text := range releaseNotes {
+        if !releaseNotesLanguages[text.Language] {
+            postSlackMessage("Sorry, Play doesn't know the language *%v* of the release notes.", text.Language)
+            valid = false
+        }
+
+        length := utf8.RuneCountInString(text.Text)
+
+        if length > maxReleaseNotesLength {
+            postSlackMessage(
+                    "Sorry, the release notes in *%v* have %v characters, but Play only accepts %v.",
+                    text.Language,
+                    length,
+                    maxReleaseNotesLength)
+            valid = false
+        }
+    }
+
+    return valid
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+    "google.golang.org/api/androidpublisher/v3"
+    "io/ioutil"
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestParseReleaseNotes(t *testing.T) {
+    tests := []struct {
+        name string
+        parse func() ([]*androidpublisher.LocalizedText, error)
+        expected string
+        failed bool
+    }{
+        {
+            name: "JSON",
+            parse: func() ([]*androidpublisher.LocalizedText, error) {
+                return parseReleaseNotesJson([]byte(`{"en-US": " Fixes. ", "de-DE": "Korrekturen."}`))
+            },
+            expected: "de-DE=Korrekturen. en-US=Fixes.",
+        },
+        {
+            name: "empty JSON",
+            parse: func() ([]*androidpublisher.LocalizedText, error) {
+                return parseReleaseNotesJson([]byte(`{}`))
+            },
+        },
+        {
+            name: "invalid JSON",
+            parse: func() ([]*androidpublisher.LocalizedText, error) {
+                return parseReleaseNotesJson([]byte(`{"en-US": 1}`))
+            },
+            failed: true,
+        },
+        {
+            name: "CSV with a header",
+            parse: func() ([]*androidpublisher.LocalizedText, error) {
+                return parseReleaseNotesCsv([]byte("language,text\nen-US,\"Fixes, mostly.\"\nde-DE,Korrekturen.\n"))
+            },
+            expected: "de-DE=Korrekturen. en-US=Fixes, mostly.",
+        },
+        {
+            name: "CSV with only a header",
+            parse: func() ([]*androidpublisher.LocalizedText, error) {
+                return parseReleaseNotesCsv([]byte("language,text\n"))
+            },
+        },
+        {
+            name: "CSV with a missing text",
+            parse: func() ([]*androidpublisher.LocalizedText, error) {
+                return parseReleaseNotesCsv([]byte("en-US\n"))
+            },
+            failed: true,
+        },
+        {
+            name: "zip",
+            parse: func() ([]*androidpublisher.LocalizedText, error) {
+                return parseTestReleaseNotesZip(map[string][]byte {
+                    "release-notes/": nil,
+                    "release-notes/en-US.txt": []byte("Fixes.\n"),
+                })
+            },
+            expected: "en-US=Fixes.",
+        },
+        {
+            name: "zip with only directories",
+            parse: func() ([]*androidpublisher.LocalizedText, error) {
+                return parseTestReleaseNotesZip(map[string][]byte {"release-notes/": nil})
+            },
+        },
+    }
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            releaseNotes, err := test.parse()
+
+            if test.failed {
+                if err == nil {
+                    t.Error("expected an error")
+                }
+
+                return
+            }
+
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            if releaseNotes == nil {
+                t.Fatal("expected release notes, even if there are none")
+            }
+
+            var actual []string
+
+            for _, text := range releaseNotes {
+                actual = append(actual, text.Language + "=" + text.Text)
+            }
+
+            if strings.Join(actual, " ") != test.expected {
+                t.Errorf("expected %q, got %q", test.expected, strings.Join(actual, " "))
+            }
+        })
+    }
+}
+
+func parseTestReleaseNotesZip(files map[string][]byte) ([]*androidpublisher.LocalizedText, error) {
+    file, err := ioutil.TempFile("", "")
+
+    if err != nil {
+        return nil, err
+    }
+
+    defer os.Remove(file.Name())
+    defer file.Close()
+
+    _, err = file.Write(newTestZip(files))
+
+    if err != nil {
+        return nil, err
+    }
+
+    return parseReleaseNotesZip(file)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+    "context"
+    "golang.org/x/oauth2"
+    "google.golang.org/api/androidpublisher/v3"
+    "google.golang.org/api/googleapi"
+    "io"
+)
+
+type storePublisher interface {
+    commitEdit(appId string, editId string) error
+    deleteEdit(appId string, editId string) error
+    insertEdit(appId string) (*androidpublisher.AppEdit, error)
+    listTracks(appId string, editId string) ([]*androidpublisher.Track, error)
+    shareApk(appId string, media io.Reader) (*androidpublisher.InternalAppSharingArtifact, error)
+    shareBundle(appId string, media io.Reader) (*androidpublisher.InternalAppSharingArtifact, error)
+    updateTrack(appId string, editId string, track *androidpublisher.Track) error
+    uploadApk(appId string, editId string, media io.Reader) (*androidpublisher.Apk, error)
+    uploadBundle(appId string, editId string, media io.Reader) (*androidpublisher.Bundle, error)
+    uploadDeobfuscationFile(appId string, editId string, appVersionCode int64, fileType string, media io.Reader) error
+    validateEdit(appId string, editId string) error
+}
+
+type googleStorePublisher struct {
+    context context.Context
+    service *androidpublisher.Service
+}
+
+// The factory for the publisher used by all commands, replaceable by a fake.
+var createStorePublisher = createGoogleStorePublisher
+
+func createGoogleStorePublisher(ctx context.Context) storePublisher {
+    credentials := loadStoreCredentials()
+
+    if credentials == nil {
+        return nil
+    }
+
+    client := credentials.Client(oauth2.NoContext)
+
+    service, err := androidpublisher.New(client)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't create the publisher: %v", err)
+        return nil
+    }
+
+    return &googleStorePublisher {
+        context: ctx,
+        service: service,
+    }
+}
+
+func (publisher *googleStorePublisher) commitEdit(appId string, editId string) error {
+    _, err := publisher.service.Edits.
+            Commit(appId, editId).
+            Context(publisher.context).
+            Do()
+
+    return err
+}
+
+// Deletes the edit even if the context is done, so cancelled commands can clean up.
+func (publisher *googleStorePublisher) deleteEdit(appId string, editId string) error {
+    return publisher.service.Edits.
+            Delete(appId, editId).
+            Do()
+}
+
+func (publisher *googleStorePublisher) insertEdit(appId string) (*androidpublisher.AppEdit, error) {
+    return publisher.service.Edits.
+            Insert(appId, nil).
+            Context(publisher.context).
+            Do()
+}
+
+func (publisher *googleStorePublisher) listTracks(appId string, editId string) ([]*androidpublisher.Track, error) {
+    tracks, err := publisher.service.Edits.Tracks.
+            List(appId, editId).
+            Context(publisher.context).
+            Do()
+
+    if err != nil {
+        return nil, err
+    }
+
+    return tracks.Tracks, nil
+}
+
+func (publisher *googleStorePublisher) shareApk(appId string, media io.Reader) (*androidpublisher.InternalAppSharingArtifact, error) {
+    return publisher.service.Internalappsharingartifacts.
+            Uploadapk(appId).
+            Media(media, googleapi.ContentType("application/vnd.android.package-archive")).
+            Context(publisher.context).
+            Do()
+}
+
+func (publisher *googleStorePublisher) shareBundle(appId string, media io.Reader) (*androidpublisher.InternalAppSharingArtifact, error) {
+    return publisher.service.Internalappsharingartifacts.
+            Uploadbundle(appId).
+            Media(media, googleapi.ContentType("application/octet-stream")).
+            Context(publisher.context).
+            Do()
+}
+
+func (publisher *googleStorePublisher) updateTrack(appId string, editId string, track *androidpublisher.Track) error {
+    _, err := publisher.service.Edits.Tracks.
+            Update(appId, editId, track.Track, track).
+            Context(publisher.context).
+            Do()
+
+    return err
+}
+
+func (publisher *googleStorePublisher) uploadApk(appId string, editId string, media io.Reader) (*androidpublisher.Apk, error) {
+    return publisher.service.Edits.Apks.
+            Upload(appId, editId).
+            Media(media, googleapi.ContentType("application/vnd.android.package-archive")).
+            Context(publisher.context).
+            Do()
+}
+
+func (publisher *googleStorePublisher) uploadBundle(appId string, editId string, media io.Reader) (*androidpublisher.Bundle, error) {
+    return publisher.service.Edits.Bundles.
+            Upload(appId, editId).
+            Media(media, googleapi.ContentType("application/octet-stream")).
+            Context(publisher.context).
+            Do()
+}
+
+func (publisher *googleStorePublisher) uploadDeobfuscationFile(
+        appId string,
+        editId string,
+        appVersionCode int64,
+        fileType string,
+        media io.Reader) error {
+    _, err := publisher.service.Edits.Deobfuscationfiles.
+            Upload(appId, editId, appVersionCode, fileType).
+            Media(media, googleapi.ContentType("application/octet-stream")).
+            Context(publisher.context).
+            Do()
+
+    return err
+}
+
+func (publisher *googleStorePublisher) validateEdit(appId string, editId string) error {
+    _, err := publisher.service.Edits.
+            Validate(appId, editId).
+            Context(publisher.context).
+            Do()
+
+    return err
+}
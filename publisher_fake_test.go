@@ -0,0 +1,283 @@
+package main
+
+import (
+    "fmt"
+    "google.golang.org/api/androidpublisher/v3"
+    "io"
+    "io/ioutil"
+    "sort"
+    "sync"
+)
+
+// An in-memory publisher that keeps the tracks of every app, used by the tests like this:
+//
+//     publisher := newFakeStorePublisher()
+//     publisher.setTracks("com.example.app", &androidpublisher.Track {
+//         Track: "beta",
+//         Releases: []*androidpublisher.TrackRelease {newStoreRelease("1.0.0", 1, 0, nil)},
+//     })
+//     createStorePublisher = func(ctx context.Context) storePublisher { return publisher }
+type fakeStorePublisher struct {
+    mutex sync.Mutex
+    apps map[string]map[string]*androidpublisher.Track
+    edits map[string]*fakeStoreEdit
+    // The errors of the methods that fail, by method name, e.g. "updateTrack" or "upload".
+    failures map[string]error
+    lastEditId int
+    lastSharedArtifactId int
+    lastVersionCode int64
+}
+
+type fakeStoreEdit struct {
+    appId string
+    tracks map[string]*androidpublisher.Track
+}
+
+func newFakeStorePublisher() *fakeStorePublisher {
+    return &fakeStorePublisher {
+        apps: map[string]map[string]*androidpublisher.Track {},
+        edits: map[string]*fakeStoreEdit {},
+        failures: map[string]error {},
+        lastVersionCode: 100,
+    }
+}
+
+func sortFakeStoreTracks(tracks []*androidpublisher.Track) {
+    sort.Slice(tracks, func(left int, right int) bool {
+        return tracks[left].Track < tracks[right].Track
+    })
+}
+
+func (publisher *fakeStorePublisher) commitEdit(appId string, editId string) error {
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    edit, err := publisher.findEdit(appId, editId)
+
+    if err != nil {
+        return err
+    }
+
+    publisher.apps[appId] = edit.tracks
+
+    delete(publisher.edits, editId)
+
+    return nil
+}
+
+func (publisher *fakeStorePublisher) deleteEdit(appId string, editId string) error {
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    _, err := publisher.findEdit(appId, editId)
+
+    if err != nil {
+        return err
+    }
+
+    delete(publisher.edits, editId)
+
+    return nil
+}
+
+func (publisher *fakeStorePublisher) findEdit(appId string, editId string) (*fakeStoreEdit, error) {
+    edit, exists := publisher.edits[editId]
+
+    if !exists || edit.appId != appId {
+        return nil, fmt.Errorf("edit %v doesn't exist for %v", editId, appId)
+    }
+
+    return edit, nil
+}
+
+func (publisher *fakeStorePublisher) getTracks(appId string) []*androidpublisher.Track {
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    var result []*androidpublisher.Track
+
+    for _, track := range publisher.apps[appId] {
+        result = append(result, copyStoreTrack(track))
+    }
+
+    sortFakeStoreTracks(result)
+
+    return result
+}
+
+func (publisher *fakeStorePublisher) insertEdit(appId string) (*androidpublisher.AppEdit, error) {
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    publisher.lastEditId++
+
+    edit := &fakeStoreEdit {
+        appId: appId,
+        tracks: map[string]*androidpublisher.Track {},
+    }
+
+    for name, track := range publisher.apps[appId] {
+        edit.tracks[name] = copyStoreTrack(track)
+    }
+
+    editId := fmt.Sprintf("edit-%v", publisher.lastEditId)
+
+    publisher.edits[editId] = edit
+
+    return &androidpublisher.AppEdit {Id: editId}, nil
+}
+
+func (publisher *fakeStorePublisher) listTracks(appId string, editId string) ([]*androidpublisher.Track, error) {
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    edit, err := publisher.findEdit(appId, editId)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var result []*androidpublisher.Track
+
+    for _, track := range edit.tracks {
+        result = append(result, copyStoreTrack(track))
+    }
+
+    sortFakeStoreTracks(result)
+
+    return result, nil
+}
+
+func (publisher *fakeStorePublisher) setTracks(appId string, tracks ...*androidpublisher.Track) {
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    publisher.apps[appId] = map[string]*androidpublisher.Track {}
+
+    for _, track := range tracks {
+        publisher.apps[appId][track.Track] = copyStoreTrack(track)
+    }
+}
+
+func (publisher *fakeStorePublisher) share(appId string, media io.Reader) (*androidpublisher.InternalAppSharingArtifact, error) {
+    _, err := io.Copy(ioutil.Discard, media)
+
+    if err != nil {
+        return nil, err
+    }
+
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    publisher.lastSharedArtifactId++
+
+    return &androidpublisher.InternalAppSharingArtifact {
+        CertificateFingerprint: "00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF",
+        DownloadUrl: fmt.Sprintf("https://play.google.com/apps/test/%v/%v", appId, publisher.lastSharedArtifactId),
+    }, nil
+}
+
+func (publisher *fakeStorePublisher) shareApk(appId string, media io.Reader) (*androidpublisher.InternalAppSharingArtifact, error) {
+    return publisher.share(appId, media)
+}
+
+func (publisher *fakeStorePublisher) shareBundle(appId string, media io.Reader) (*androidpublisher.InternalAppSharingArtifact, error) {
+    return publisher.share(appId, media)
+}
+
+func (publisher *fakeStorePublisher) updateTrack(appId string, editId string, track *androidpublisher.Track) error {
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    edit, err := publisher.findEdit(appId, editId)
+
+    if err != nil {
+        return err
+    }
+
+    err = publisher.failures["updateTrack"]
+
+    if err != nil {
+        return err
+    }
+
+    edit.tracks[track.Track] = copyStoreTrack(track)
+
+    return nil
+}
+
+func (publisher *fakeStorePublisher) uploadApk(appId string, editId string, media io.Reader) (*androidpublisher.Apk, error) {
+    versionCode, err := publisher.upload(appId, editId, media)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return &androidpublisher.Apk {VersionCode: versionCode}, nil
+}
+
+func (publisher *fakeStorePublisher) uploadBundle(appId string, editId string, media io.Reader) (*androidpublisher.Bundle, error) {
+    versionCode, err := publisher.upload(appId, editId, media)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return &androidpublisher.Bundle {VersionCode: versionCode}, nil
+}
+
+func (publisher *fakeStorePublisher) uploadDeobfuscationFile(
+        appId string,
+        editId string,
+        appVersionCode int64,
+        fileType string,
+        media io.Reader) error {
+    _, err := io.Copy(ioutil.Discard, media)
+
+    if err != nil {
+        return err
+    }
+
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    _, err = publisher.findEdit(appId, editId)
+
+    return err
+}
+
+func (publisher *fakeStorePublisher) upload(appId string, editId string, media io.Reader) (int64, error) {
+    _, err := io.Copy(ioutil.Discard, media)
+
+    if err != nil {
+        return 0, err
+    }
+
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    _, err = publisher.findEdit(appId, editId)
+
+    if err != nil {
+        return 0, err
+    }
+
+    err = publisher.failures["upload"]
+
+    if err != nil {
+        return 0, err
+    }
+
+    publisher.lastVersionCode++
+
+    return publisher.lastVersionCode, nil
+}
+
+func (publisher *fakeStorePublisher) validateEdit(appId string, editId string) error {
+    publisher.mutex.Lock()
+    defer publisher.mutex.Unlock()
+
+    _, err := publisher.findEdit(appId, editId)
+
+    return err
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+// A staged rollout that moves on to the next user percentage every interval, stored in the schedule file.
+type rolloutSchedule struct {
+    Id int `json:"id"`
+    User string `json:"user"`
+    App string `json:"app"`
+    VersionCode int64 `json:"versionCode"`
+    Track string `json:"track"`
+    UserPercentages []int `json:"userPercentages"`
+    Interval time.Duration `json:"interval"`
+    NextStep int `json:"nextStep"`
+    NextTime time.Time `json:"nextTime"`
+
+    // The job that applies the next step, if any.
+    job *job
+
+    // Whether the scheduler is submitting the job right now.
+    submitting bool
+}
+
+// How often the scheduler looks for steps that are due.
+const scheduleCheckInterval = time.Minute
+
+// Applies one step of a schedule, submitted by the scheduler as a job of its own.
+var scheduleStepCommand = &command {
+    name: "scheduled rollout",
+    mutating: true,
+    permission: permissionEveryone,
+    handler: func(ctx context.Context, arguments *commandArguments) bool {
+        return runScheduleStep(ctx, arguments.scheduleId)
+    },
+}
+
+var scheduleMutex sync.Mutex
+
+var schedules []*rolloutSchedule
+
+var lastScheduleId int
+
+func addSchedule(
+        user string,
+        app string,
+        appVersionCode int64,
+        storeTrack string,
+        userPercentages []int,
+        interval time.Duration) (*rolloutSchedule, error) {
+    scheduleMutex.Lock()
+    defer scheduleMutex.Unlock()
+
+    lastScheduleId++
+
+    schedule := &rolloutSchedule {
+        Id: lastScheduleId,
+        User: user,
+        App: app,
+        VersionCode: appVersionCode,
+        Track: storeTrack,
+        UserPercentages: userPercentages,
+        Interval: interval,
+        NextTime: time.Now(),
+    }
+
+    schedules = append(schedules, schedule)
+
+    err := saveSchedules()
+
+    if err != nil {
+        removeScheduleLocked(schedule.Id)
+        return nil, err
+    }
+
+    return schedule, nil
+}
+
+// Moves the schedule on to its next step and forgets it after the last one.
+// Returns whether the schedule is finished.
+func advanceSchedule(id int) (bool, error) {
+    scheduleMutex.Lock()
+    defer scheduleMutex.Unlock()
+
+    schedule := findScheduleLocked(id)
+
+    if schedule == nil {
+        return true, nil
+    }
+
+    schedule.NextStep++
+    schedule.NextTime = time.Now().Add(schedule.Interval)
+
+    finished := schedule.NextStep >= len(schedule.UserPercentages)
+
+    if finished {
+        removeScheduleLocked(id)
+    }
+
+    return finished, saveSchedules()
+}
+
+// Records the creation or cancellation of a schedule in the audit log, next to the jobs of its steps.
+func auditSchedule(schedule *rolloutSchedule, user string, text string) {
+    now := time.Now()
+
+    err := appendAuditEntry(&auditEntry {
+        User: user,
+        Command: text,
+        App: schedule.App,
+        VersionCode: schedule.VersionCode,
+        Track: schedule.Track,
+        Outcome: jobStatusSucceeded,
+        Started: now,
+        Finished: now,
+    })
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't write schedule *#%v* to the audit log: %v", schedule.Id, err)
+    }
+}
+
+// Cancels the schedules of the version code, e.g. when its rollout gets halted.
+func cancelSchedulesOf(app string, appVersionCode int64) {
+    scheduleMutex.Lock()
+
+    var ids []int
+
+    for _, schedule := range schedules {
+        if schedule.App == app && schedule.VersionCode == appVersionCode {
+            ids = append(ids, schedule.Id)
+        }
+    }
+
+    for _, id := range ids {
+        removeScheduleLocked(id)
+    }
+
+    var err error
+
+    if len(ids) > 0 {
+        err = saveSchedules()
+    }
+
+    scheduleMutex.Unlock()
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't save the schedules: %v", err)
+    }
+
+    for _, id := range ids {
+        postSlackMessage("I cancelled schedule *#%v* of that version code.", id)
+    }
+}
+
+// Halts the rollout and cancels the schedule when the version breaches a health threshold.
+// Returns false if the step must not happen now.
+func checkScheduleHealth(ctx context.Context, schedule *rolloutSchedule) bool {
+    breaches, ok := checkStoreReleaseHealth(ctx, schedule.App, schedule.VersionCode)
+
+    if !ok {
+        err := postponeSchedule(schedule.Id, healthRetryInterval)
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't save the schedules: %v", err)
+        }
+
+        postSlackMessage(
+                "Sorry, I can't check the health of *%v*, so I postponed schedule *#%v* by %v.",
+                schedule.App,
+                schedule.Id,
+                healthRetryInterval)
+        return false
+    }
+
+    if len(breaches) == 0 {
+        return true
+    }
+
+    postSlackMessage(
+            "<!channel> *%v* with version code *%v* isn't healthy: %v.",
+            schedule.App,
+            schedule.VersionCode,
+            strings.Join(breaches, ", "))
+
+    _, err := removeSchedule(schedule.Id)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't save the schedules: %v", err)
+    }
+
+    postSlackMessage("I cancelled schedule *#%v*, halting the rollout.", schedule.Id)
+
+    doHalt(ctx, schedule.App, schedule.VersionCode, false)
+
+    return false
+}
+
+func findSchedule(id int) *rolloutSchedule {
+    scheduleMutex.Lock()
+    defer scheduleMutex.Unlock()
+
+    schedule := findScheduleLocked(id)
+
+    if schedule == nil {
+        return nil
+    }
+
+    result := *schedule
+
+    return &result
+}
+
+// Must be called while holding the schedule mutex.
+func findScheduleLocked(id int) *rolloutSchedule {
+    for _, schedule := range schedules {
+        if schedule.Id == id {
+            return schedule
+        }
+    }
+
+    return nil
+}
+
+func formatSchedule(schedule *rolloutSchedule) string {
+    var userPercentages []string
+
+    for index, userPercentage := range schedule.UserPercentages {
+        if index == schedule.NextStep {
+            userPercentages = append(userPercentages, fmt.Sprintf("*%v%%*", userPercentage))
+        } else {
+            userPercentages = append(userPercentages, fmt.Sprintf("%v%%", userPercentage))
+        }
+    }
+
+    return fmt.Sprintf(
+            "Schedule *#%v* by <@%v> rolls out *%v* with version code *%v* on track *%v* to %v every *%v*, next step at %v.",
+            schedule.Id,
+            schedule.User,
+            schedule.App,
+            schedule.VersionCode,
+            schedule.Track,
+            strings.Join(userPercentages, ", "),
+            schedule.Interval,
+            schedule.NextTime.Format("Mon 3:04PM"))
+}
+
+func getScheduleFileName() string {
+    return getOptionalConfig("SCHEDULE_FILE", "schedules.json")
+}
+
+func listSchedules() []*rolloutSchedule {
+    scheduleMutex.Lock()
+    defer scheduleMutex.Unlock()
+
+    var result []*rolloutSchedule
+
+    for _, schedule := range schedules {
+        scheduleCopy := *schedule
+        result = append(result, &scheduleCopy)
+    }
+
+    return result
+}
+
+func loadSchedules() error {
+    scheduleMutex.Lock()
+    defer scheduleMutex.Unlock()
+
+    data, err := ioutil.ReadFile(getScheduleFileName())
+
+    if os.IsNotExist(err) {
+        return nil
+    }
+
+    if err != nil {
+        return err
+    }
+
+    err = json.Unmarshal(data, &schedules)
+
+    if err != nil {
+        return err
+    }
+
+    for _, schedule := range schedules {
+        if schedule.Id > lastScheduleId {
+            lastScheduleId = schedule.Id
+        }
+    }
+
+    return nil
+}
+
+func postponeSchedule(id int, delay time.Duration) error {
+    scheduleMutex.Lock()
+    defer scheduleMutex.Unlock()
+
+    schedule := findScheduleLocked(id)
+
+    if schedule == nil {
+        return nil
+    }
+
+    schedule.NextTime = time.Now().Add(delay)
+
+    return saveSchedules()
+}
+
+func removeSchedule(id int) (bool, error) {
+    scheduleMutex.Lock()
+    defer scheduleMutex.Unlock()
+
+    if !removeScheduleLocked(id) {
+        return false, nil
+    }
+
+    return true, saveSchedules()
+}
+
+// Must be called while holding the schedule mutex.
+func removeScheduleLocked(id int) bool {
+    for index, schedule := range schedules {
+        if schedule.Id == id {
+            schedules = append(schedules[:index], schedules[index + 1:]...)
+            return true
+        }
+    }
+
+    return false
+}
+
+func runScheduleStep(ctx context.Context, id int) bool {
+    schedule := findSchedule(id)
+
+    if schedule == nil {
+        postSlackMessage("Sorry, I can't find schedule *#%v*.", id)
+        return false
+    }
+
+    userPercentage := schedule.UserPercentages[schedule.NextStep]
+
+    // Only increase a rollout that is healthy so far.
+
+    if schedule.NextStep > 0 && !checkScheduleHealth(ctx, schedule) {
+        return false
+    }
+
+    postSlackMessage(
+            "Step %v of %v of schedule *#%v*: rolling out to *%v%%*.",
+            schedule.NextStep + 1,
+            len(schedule.UserPercentages),
+            schedule.Id,
+            userPercentage)
+
+    if !doRollout(ctx, schedule.App, schedule.VersionCode, schedule.Track, userPercentage, false) {
+
+        // Don't keep rolling out a version that needs attention.
+
+        _, err := removeSchedule(id)
+
+        if err != nil {
+            postSlackMessage("Sorry, I can't save the schedules: %v", err)
+        }
+
+        postSlackMessage("Sorry, the step failed, so I cancelled schedule *#%v*.", id)
+        return false
+    }
+
+    finished, err := advanceSchedule(id)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't save the schedules: %v", err)
+    }
+
+    if finished {
+        postSlackMessage("Schedule *#%v* is finished.", id)
+    }
+
+    return true
+}
+
+// Submits a job for every schedule whose next step is due.
+func runSchedules() {
+    scheduleMutex.Lock()
+
+    var dueSchedules []*rolloutSchedule
+
+    for _, schedule := range schedules {
+        if schedule.submitting || schedule.job != nil && !isJobFinished(schedule.job) {
+            continue
+        }
+
+        // Claim the step, so a check running at the same time doesn't submit it again.
+
+        if !schedule.NextTime.After(time.Now()) {
+            schedule.submitting = true
+
+            scheduleCopy := *schedule
+            dueSchedules = append(dueSchedules, &scheduleCopy)
+        }
+    }
+
+    scheduleMutex.Unlock()
+
+    for _, schedule := range dueSchedules {
+        arguments := &commandArguments {
+            app: schedule.App,
+            scheduleId: schedule.Id,
+            storeTrack: schedule.Track,
+            user: schedule.User,
+            userPercentage: schedule.UserPercentages[schedule.NextStep],
+            versionCode: schedule.VersionCode,
+        }
+
+        text := fmt.Sprintf(
+                "rollout %v %v on %v to %v%% (schedule #%v)",
+                schedule.App,
+                schedule.VersionCode,
+                schedule.Track,
+                arguments.userPercentage,
+                schedule.Id)
+
+        // If the app is busy, the step is tried again at the next check without bothering the channel
+        // or filling the history with a rejection every time.
+
+        job, lockingJob := trySubmitJob(scheduleStepCommand, arguments, text)
+
+        if lockingJob != nil {
+            job = nil
+        }
+
+        scheduleMutex.Lock()
+
+        runningSchedule := findScheduleLocked(schedule.Id)
+
+        if runningSchedule != nil {
+            runningSchedule.submitting = false
+
+            if job != nil {
+                runningSchedule.job = job
+            }
+        }
+
+        scheduleMutex.Unlock()
+
+        if job == nil {
+            continue
+        }
+
+        postSlackMessage("Schedule *#%v* is due, that's job *#%v*.", schedule.Id, job.id)
+    }
+}
+
+// Must be called while holding the schedule mutex.
+func saveSchedules() error {
+    data, err := json.MarshalIndent(schedules, "", "  ")
+
+    if err != nil {
+        return err
+    }
+
+    // Replace the file at once, so a crash never leaves half of it behind.
+
+    fileName := getScheduleFileName()
+
+    err = ioutil.WriteFile(fileName + ".tmp", data, 0644)
+
+    if err != nil {
+        return err
+    }
+
+    return os.Rename(fileName + ".tmp", fileName)
+}
+
+func startScheduler() {
+    err := loadSchedules()
+
+    if err != nil {
+        panic(err)
+    }
+
+    go func() {
+        for range time.Tick(scheduleCheckInterval) {
+            runSchedules()
+        }
+    }()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestCancelScheduleIsAudited(t *testing.T) {
+    startTestAuditLog(t)
+
+    schedule, err := addSchedule("U1", "app", 5, "production", []int {10, 100}, time.Hour)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if !doCancelSchedule(schedule.Id, "U1") {
+        t.Fatal("expected the schedule to be cancelled")
+    }
+
+    expectTestAuditOutcomes(t, jobStatusSucceeded)
+
+    entries, _ := loadAuditEntries()
+
+    if entries[0].Command != fmt.Sprintf("cancel schedule #%v", schedule.Id) || entries[0].App != "app" {
+        t.Errorf("unexpected audit entry %+v", entries[0])
+    }
+}
+
+func TestHaltCancelsSchedules(t *testing.T) {
+    publisher := startFakeStorePublisher(newTestTrack("production", newStoreRelease("1.0.0", 5, 0.1, nil)))
+
+    schedule, err := addSchedule("U1", "app", 5, "production", []int {10, 50, 100}, time.Hour)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if !doHalt(context.Background(), "app", 5, false) {
+        t.Fatal("expected the rollout to be halted")
+    }
+
+    if findSchedule(schedule.Id) != nil {
+        t.Error("expected the schedule to be cancelled")
+    }
+
+    expected := "production: 1.0.0 [5] halted 0.1"
+    actual := formatTestTracks(publisher.getTracks(testAppId))
+
+    if actual != expected {
+        t.Errorf("expected %q, got %q", expected, actual)
+    }
+}
+
+func TestRunSchedules(t *testing.T) {
+    savedJobQueue := jobQueue
+    defer func() { jobQueue = savedJobQueue }()
+
+    t.Run("submits a due step once", func(t *testing.T) {
+        startTestAuditLog(t)
+
+        jobQueue = make(chan *job, 2)
+
+        schedule, err := addSchedule("U1", "app", 5, "production", []int {10, 50, 100}, time.Hour)
+
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        defer removeSchedule(schedule.Id)
+
+        // The Slack loop and the ticker both check the schedules.
+
+        var waitGroup sync.WaitGroup
+
+        for index := 0; index < 2; index++ {
+            waitGroup.Add(1)
+
+            go func() {
+                defer waitGroup.Done()
+                runSchedules()
+            }()
+        }
+
+        waitGroup.Wait()
+
+        if len(jobQueue) != 1 {
+            t.Fatalf("expected 1 job, got %v", len(jobQueue))
+        }
+
+        cancelJob(<-jobQueue)
+
+        expectTestAuditOutcomes(t, jobStatusCancelled)
+    })
+
+    t.Run("retries quietly while the app is busy", func(t *testing.T) {
+        startTestAuditLog(t)
+
+        jobQueue = make(chan *job, 2)
+
+        lockingJob := submitJob(testJobCommand, &commandArguments {app: "app", user: "U1"}, "test app")
+        defer cancelJob(lockingJob)
+
+        schedule, err := addSchedule("U1", "app", 5, "production", []int {10, 50, 100}, time.Hour)
+
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        defer removeSchedule(schedule.Id)
+
+        var output bytes.Buffer
+
+        log.SetOutput(&output)
+        runSchedules()
+        log.SetOutput(os.Stderr)
+
+        if strings.Contains(output.String(), "busy") {
+            t.Errorf("expected no busy message, got %q", output.String())
+        }
+
+        expectTestAuditOutcomes(t)
+
+        // The step must be tried again at the next check.
+
+        cancelJob(lockingJob)
+        runSchedules()
+
+        if len(jobQueue) != 2 {
+            t.Fatalf("expected the step to be submitted, got %v jobs", len(jobQueue))
+        }
+
+        <-jobQueue
+        cancelJob(<-jobQueue)
+    })
+}
+
+func TestScheduleStepCompletesRollout(t *testing.T) {
+    publisher := startFakeStorePublisher(newTestTrack(
+            "production",
+            newStoreRelease("0.9.0", 4, 0, nil),
+            newStoreRelease("1.0.0", 5, 0.5, nil)))
+
+    schedule, err := addSchedule("U1", "app", 5, "production", []int {10, 50, 100}, time.Hour)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for index := 0; index < 2; index++ {
+        _, err = advanceSchedule(schedule.Id)
+
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    if !runScheduleStep(context.Background(), schedule.Id) {
+        t.Fatal("expected the step to succeed")
+    }
+
+    if findSchedule(schedule.Id) != nil {
+        t.Error("expected the schedule to be finished")
+    }
+
+    expected := "production: 1.0.0 [5] completed"
+    actual := formatTestTracks(publisher.getTracks(testAppId))
+
+    if actual != expected {
+        t.Errorf("expected %q, got %q", expected, actual)
+    }
+}
+
+func TestScheduleStepRefusesHaltedRollout(t *testing.T) {
+    publisher := startFakeStorePublisher(newTestTrack("production", newTestHaltedRelease("1.0.0", 5, 0.1)))
+
+    schedule, err := addSchedule("U1", "app", 5, "production", []int {10, 50, 100}, time.Hour)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if runScheduleStep(context.Background(), schedule.Id) {
+        t.Error("expected the step to be refused")
+    }
+
+    if findSchedule(schedule.Id) != nil {
+        t.Error("expected the schedule to be cancelled")
+    }
+
+    expected := "production: 1.0.0 [5] halted 0.1"
+    actual := formatTestTracks(publisher.getTracks(testAppId))
+
+    if actual != expected {
+        t.Errorf("expected %q, got %q", expected, actual)
+    }
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+    "archive/zip"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/asn1"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path"
+    "strings"
+)
+
+// The certificate a signature scheme found in an artifact.
+type artifactSignature struct {
+    scheme string
+    certificate []byte
+}
+
+type pkcs7ContentInfo struct {
+    ContentType asn1.ObjectIdentifier
+    Content asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+    Version int
+    DigestAlgorithms asn1.RawValue
+    ContentInfo asn1.RawValue
+    Certificates asn1.RawValue `asn1:"optional,tag:0"`
+    Crls asn1.RawValue `asn1:"optional,tag:1"`
+    SignerInfos asn1.RawValue
+}
+
+// The IDs of the signature schemes in the APK signing block.
+var apkSignatureSchemes = map[string]uint32 {
+    "v2": 0x7109871a,
+    "v3": 0xf05368c0,
+}
+
+const apkSigningBlockMagic = "APK Sig Block 42"
+
+const zipEndOfCentralDirectorySignature = 0x06054b50
+
+// Refuses artifacts that aren't signed with the certificate pinned for the app, e.g. with
+// ANDROID_CERTIFICATE_FINGERPRINT_MY_APP=AB:CD:... for the app my-app.
+//
+// Only the newest signature scheme in the artifact counts: after a key rotation, v3 carries the new
+// certificate, which is the one to pin, while v2 and v1 keep the old one for older devices.
+func checkArtifactSignature(file *os.File, artifactId string) bool {
+    pinnedFingerprint := getOptionalAppConfig("ANDROID_CERTIFICATE_FINGERPRINT", artifactId, "")
+
+    if len(pinnedFingerprint) == 0 {
+        postSlackMessage("There's no pinned certificate for *%v*, so I didn't check the signature.", artifactId)
+        return true
+    }
+
+    signatures, err := readArtifactSignatures(file)
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't read the signature of the artifact: %v", err)
+        return false
+    }
+
+    if len(signatures) == 0 {
+        postSlackMessage("Sorry, the artifact isn't signed.")
+        return false
+    }
+
+    valid := true
+
+    for _, signature := range signatures {
+        if signature.scheme != signatures[0].scheme {
+            continue
+        }
+
+        fingerprint := formatCertificateFingerprint(signature.certificate)
+
+        if normalizeCertificateFingerprint(fingerprint) != normalizeCertificateFingerprint(pinnedFingerprint) {
+            postSlackMessage(
+                    "Sorry, the %v signature of the artifact has the certificate *%v*, not the pinned one.",
+                    signature.scheme,
+                    fingerprint)
+            valid = false
+        }
+    }
+
+    if valid {
+        postSlackMessage("The %v signature of the artifact has the pinned certificate.", signatures[0].scheme)
+    }
+
+    return valid
+}
+
+func formatCertificateFingerprint(certificate []byte) string {
+    digest := sha256.Sum256(certificate)
+
+    var result []string
+
+    for _, value := range digest {
+        result = append(result, fmt.Sprintf("%02X", value))
+    }
+
+    return strings.Join(result, ":")
+}
+
+func normalizeCertificateFingerprint(fingerprint string) string {
+    return strings.ToUpper(strings.NewReplacer(":", "", " ", "").Replace(fingerprint))
+}
+
+// Reads the certificate of the first signer of an APK signature scheme v2 or v3 block.
+// Both start with the signers, whose signed data starts with the digests and the certificates.
+func parseApkSignatureSchemeCertificate(data []byte) ([]byte, error) {
+    signers, _, err := readLengthPrefixedBytes(data)
+
+    if err != nil {
+        return nil, err
+    }
+
+    signer, _, err := readLengthPrefixedBytes(signers)
+
+    if err != nil {
+        return nil, err
+    }
+
+    signedData, _, err := readLengthPrefixedBytes(signer)
+
+    if err != nil {
+        return nil, err
+    }
+
+    _, signedData, err = readLengthPrefixedBytes(signedData)
+
+    if err != nil {
+        return nil, err
+    }
+
+    certificates, _, err := readLengthPrefixedBytes(signedData)
+
+    if err != nil {
+        return nil, err
+    }
+
+    certificate, _, err := readLengthPrefixedBytes(certificates)
+
+    return certificate, err
+}
+
+// Reads the certificate of the first signer of a JAR signature, as in META-INF/CERT.RSA.
+func parsePkcs7Certificate(data []byte) ([]byte, error) {
+    var contentInfo pkcs7ContentInfo
+
+    _, err := asn1.Unmarshal(data, &contentInfo)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var signedData pkcs7SignedData
+
+    _, err = asn1.Unmarshal(contentInfo.Content.Bytes, &signedData)
+
+    if err != nil {
+        return nil, err
+    }
+
+    certificates, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if len(certificates) == 0 {
+        return nil, errors.New("no certificate")
+    }
+
+    return certificates[0].Raw, nil
+}
+
+// Reads the ID-value pairs of the APK signing block, which sits right before the central directory.
+// Returns nil if there is no signing block.
+func readApkSigningBlock(file *os.File) (map[uint32][]byte, error) {
+    info, err := file.Stat()
+
+    if err != nil {
+        return nil, err
+    }
+
+    // The end of central directory record is at most 64 KB of comment away from the end.
+
+    tailSize := info.Size()
+
+    if tailSize > 65535 + 22 {
+        tailSize = 65535 + 22
+    }
+
+    tail := make([]byte, tailSize)
+
+    _, err = file.ReadAt(tail, info.Size() - tailSize)
+
+    if err != nil {
+        return nil, err
+    }
+
+    endOffset := -1
+
+    for offset := len(tail) - 22; offset >= 0; offset-- {
+        if binary.LittleEndian.Uint32(tail[offset:]) == zipEndOfCentralDirectorySignature {
+            endOffset = offset
+            break
+        }
+    }
+
+    if endOffset < 0 {
+        return nil, errors.New("not a zip file")
+    }
+
+    centralDirectoryOffset := int64(binary.LittleEndian.Uint32(tail[endOffset + 16:]))
+
+    if centralDirectoryOffset < 32 {
+        return nil, nil
+    }
+
+    footer := make([]byte, 24)
+
+    _, err = file.ReadAt(footer, centralDirectoryOffset - 24)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if string(footer[8:]) != apkSigningBlockMagic {
+        return nil, nil
+    }
+
+    blockSize := int64(binary.LittleEndian.Uint64(footer))
+
+    if blockSize < 24 || blockSize + 8 > centralDirectoryOffset {
+        return nil, errors.New("invalid APK signing block")
+    }
+
+    block := make([]byte, blockSize - 24)
+
+    _, err = file.ReadAt(block, centralDirectoryOffset - blockSize)
+
+    if err != nil {
+        return nil, err
+    }
+
+    result := map[uint32][]byte {}
+
+    for len(block) > 0 {
+        if len(block) < 12 {
+            return nil, errors.New("invalid APK signing block")
+        }
+
+        pairSize := binary.LittleEndian.Uint64(block)
+
+        if pairSize < 4 || pairSize > uint64(len(block) - 8) {
+            return nil, errors.New("invalid APK signing block")
+        }
+
+        result[binary.LittleEndian.Uint32(block[8:])] = block[12:8 + pairSize]
+
+        block = block[8 + pairSize:]
+    }
+
+    return result, nil
+}
+
+// Reads the signer certificates of the v3, v2 and v1 (JAR) signatures, whichever exist, in that order.
+func readArtifactSignatures(file *os.File) ([]*artifactSignature, error) {
+    var result []*artifactSignature
+
+    block, err := readApkSigningBlock(file)
+
+    if err != nil {
+        return nil, err
+    }
+
+    for _, scheme := range []string {"v3", "v2"} {
+        value, exists := block[apkSignatureSchemes[scheme]]
+
+        if !exists {
+            continue
+        }
+
+        certificate, err := parseApkSignatureSchemeCertificate(value)
+
+        if err != nil {
+            return nil, fmt.Errorf("invalid %v signature: %v", scheme, err)
+        }
+
+        result = append(result, &artifactSignature {scheme: scheme, certificate: certificate})
+    }
+
+    info, err := file.Stat()
+
+    if err != nil {
+        return nil, err
+    }
+
+    reader, err := zip.NewReader(file, info.Size())
+
+    if err != nil {
+        return nil, err
+    }
+
+    for _, entry := range reader.File {
+        directory, name := path.Split(entry.Name)
+        extension := strings.ToUpper(path.Ext(name))
+
+        if directory != "META-INF/" || (extension != ".RSA" && extension != ".DSA" && extension != ".EC") {
+            continue
+        }
+
+        entryReader, err := entry.Open()
+
+        if err != nil {
+            return nil, err
+        }
+
+        data, err := ioutil.ReadAll(entryReader)
+
+        entryReader.Close()
+
+        if err != nil {
+            return nil, err
+        }
+
+        certificate, err := parsePkcs7Certificate(data)
+
+        if err != nil {
+            return nil, fmt.Errorf("invalid v1 signature %v: %v", entry.Name, err)
+        }
+
+        result = append(result, &artifactSignature {scheme: "v1", certificate: certificate})
+    }
+
+    return result, nil
+}
+
+// Reads a value with a little-endian 32-bit length prefix, as used in the APK signing block.
+func readLengthPrefixedBytes(data []byte) ([]byte, []byte, error) {
+    if len(data) < 4 {
+        return nil, nil, errors.New("truncated value")
+    }
+
+    length := binary.LittleEndian.Uint32(data)
+
+    if uint64(length) > uint64(len(data) - 4) {
+        return nil, nil, errors.New("truncated value")
+    }
+
+    return data[4:4 + length], data[4 + length:], nil
+}
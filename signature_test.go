@@ -0,0 +1,202 @@
+package main
+
+import (
+    "bytes"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/asn1"
+    "encoding/binary"
+    "math/big"
+    "os"
+    "testing"
+    "time"
+)
+
+func TestCheckArtifactSignature(t *testing.T) {
+    pinnedCertificate := newTestCertificate(t, "pinned")
+    otherCertificate := newTestCertificate(t, "other")
+
+    tests := []struct {
+        name string
+        files map[string][]byte
+        schemes map[string][]byte
+        valid bool
+    }{
+        {
+            name: "APK with a v1 signature",
+            files: map[string][]byte {
+                "AndroidManifest.xml": nil,
+                "META-INF/CERT.RSA": newTestPkcs7(t, pinnedCertificate),
+            },
+            valid: true,
+        },
+        {
+            name: "APK with v2 and v3 signatures",
+            files: map[string][]byte {"AndroidManifest.xml": nil},
+            schemes: map[string][]byte {"v2": pinnedCertificate, "v3": pinnedCertificate},
+            valid: true,
+        },
+        {
+            name: "APK with a rotated key in the v3 signature",
+            files: map[string][]byte {
+                "AndroidManifest.xml": nil,
+                "META-INF/CERT.RSA": newTestPkcs7(t, otherCertificate),
+            },
+            schemes: map[string][]byte {"v2": otherCertificate, "v3": pinnedCertificate},
+            valid: true,
+        },
+        {
+            name: "app bundle with a JAR signature",
+            files: map[string][]byte {
+                "base/manifest/AndroidManifest.xml": nil,
+                "META-INF/UPLOAD.RSA": newTestPkcs7(t, pinnedCertificate),
+            },
+            valid: true,
+        },
+        {
+            name: "unsigned APK",
+            files: map[string][]byte {"AndroidManifest.xml": nil},
+        },
+        {
+            name: "APK with another certificate",
+            files: map[string][]byte {
+                "AndroidManifest.xml": nil,
+                "META-INF/CERT.RSA": newTestPkcs7(t, otherCertificate),
+            },
+            schemes: map[string][]byte {"v2": otherCertificate},
+        },
+        {
+            name: "APK with a corrupt v2 signature",
+            files: map[string][]byte {"AndroidManifest.xml": nil},
+            schemes: map[string][]byte {"v2": nil},
+        },
+    }
+
+    os.Setenv("ANDROID_CERTIFICATE_FINGERPRINT_APP", formatCertificateFingerprint(pinnedCertificate))
+    defer os.Unsetenv("ANDROID_CERTIFICATE_FINGERPRINT_APP")
+
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            data := newTestZip(test.files)
+
+            if test.schemes != nil {
+                data = addTestApkSigningBlock(data, test.schemes)
+            }
+
+            file := writeTestArtifact(t, data)
+
+            defer os.Remove(file.Name())
+            defer file.Close()
+
+            valid := checkArtifactSignature(file, "app")
+
+            if valid != test.valid {
+                t.Errorf("expected %v, got %v", test.valid, valid)
+            }
+        })
+    }
+}
+
+// Inserts an APK signing block with a signer of the certificate for every scheme before the central directory,
+// or a signer without signed data if the certificate is nil.
+func addTestApkSigningBlock(data []byte, schemes map[string][]byte) []byte {
+    endOffset := bytes.LastIndex(data, []byte {0x50, 0x4b, 0x05, 0x06})
+    centralDirectoryOffset := binary.LittleEndian.Uint32(data[endOffset + 16:])
+
+    var pairs bytes.Buffer
+
+    for scheme, certificate := range schemes {
+        var value []byte
+
+        if certificate == nil {
+            value = joinTestLengthPrefixedBytes(joinTestLengthPrefixedBytes(nil))
+        } else {
+            signedData := joinTestLengthPrefixedBytes(nil, joinTestLengthPrefixedBytes(certificate))
+            value = joinTestLengthPrefixedBytes(joinTestLengthPrefixedBytes(joinTestLengthPrefixedBytes(signedData)))
+        }
+
+        binary.Write(&pairs, binary.LittleEndian, uint64(4 + len(value)))
+        binary.Write(&pairs, binary.LittleEndian, apkSignatureSchemes[scheme])
+        pairs.Write(value)
+    }
+
+    var block bytes.Buffer
+
+    binary.Write(&block, binary.LittleEndian, uint64(pairs.Len() + 24))
+    block.Write(pairs.Bytes())
+    binary.Write(&block, binary.LittleEndian, uint64(pairs.Len() + 24))
+    block.WriteString(apkSigningBlockMagic)
+
+    var result bytes.Buffer
+
+    result.Write(data[:centralDirectoryOffset])
+    result.Write(block.Bytes())
+    result.Write(data[centralDirectoryOffset:])
+
+    binary.LittleEndian.PutUint32(result.Bytes()[endOffset + block.Len() + 16:], centralDirectoryOffset + uint32(block.Len()))
+
+    return result.Bytes()
+}
+
+func joinTestLengthPrefixedBytes(values ...[]byte) []byte {
+    var result bytes.Buffer
+
+    for _, value := range values {
+        binary.Write(&result, binary.LittleEndian, uint32(len(value)))
+        result.Write(value)
+    }
+
+    return result.Bytes()
+}
+
+func newTestCertificate(t *testing.T, name string) []byte {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    template := &x509.Certificate {
+        SerialNumber: big.NewInt(1),
+        Subject: pkix.Name {CommonName: name},
+        NotBefore: time.Now(),
+        NotAfter: time.Now().Add(time.Hour),
+    }
+
+    result, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return result
+}
+
+// A PKCS #7 signed data structure with the certificate but without signer infos, which is all the check reads.
+func newTestPkcs7(t *testing.T, certificate []byte) []byte {
+    signedData, err := asn1.Marshal(pkcs7SignedData {
+        Version: 1,
+        DigestAlgorithms: asn1.RawValue {Tag: asn1.TagSet, IsCompound: true},
+        ContentInfo: asn1.RawValue {Tag: asn1.TagSequence, IsCompound: true},
+        Certificates: asn1.RawValue {Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificate},
+        SignerInfos: asn1.RawValue {Tag: asn1.TagSet, IsCompound: true},
+    })
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    result, err := asn1.Marshal(pkcs7ContentInfo {
+        ContentType: asn1.ObjectIdentifier {1, 2, 840, 113549, 1, 7, 2},
+        Content: asn1.RawValue {Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+    })
+
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return result
+}
@@ -1,162 +1,61 @@
 package main
 
 import (
+    "bytes"
+    "errors"
     "fmt"
     "github.com/nlopes/slack"
     "log"
-    "regexp"
-    "strconv"
     "strings"
 )
 
 var rtm *slack.RTM
 
-func handleSlackMessage(event *slack.MessageEvent) {
-    text := event.Msg.Text
-
-    if len(event.User) == 0 {
-        log.Printf("#%v %v", event.Channel, text)
-    } else {
-        log.Printf("#%v %v: %v", event.Channel, event.User, text)
-    }
-
-    if event.Channel != getConfig("SLACK_BOT_CHANNEL_ID") {
-        return
+// Downloads a file that was shared with the bot, using the bot token.
+func downloadSlackFile(url string) ([]byte, error) {
+    if rtm == nil {
+        return nil, errors.New("not connected to Slack")
     }
 
-    textPrefix := fmt.Sprintf("<@%s>", getConfig("SLACK_BOT_USER_ID"))
-
-    if !strings.HasPrefix(text, textPrefix) {
-        return
-    }
-
-    // Handle the 'deploy' command.
-
-    command := regexp.
-            MustCompile("<[^>]+> +deploy +([^ ]+) +([^ ]+)").
-            FindStringSubmatch(text)
-
-    if len(command) > 0 {
-        doDeploy(command[1], command[2])
-        return
-    }
+    var content bytes.Buffer
 
-    // Handle the 'halt' command.
-
-    command = regexp.
-            MustCompile("<[^>]+> +halt +([^ ]+) +([^ ]+)").
-            FindStringSubmatch(text)
-
-    if len(command) > 0 {
-        appVersionCode, err := strconv.ParseInt(command[2], 10, 64)
-
-        if err != nil {
-            postSlackMessage("Sorry, I don't understand that version code.")
-            return
-        }
-
-        doHalt(command[1], appVersionCode)
-        return
-    }
-
-    // Handle the 'ping' command.
-
-    command = regexp.
-            MustCompile("<[^>]+> +ping").
-            FindStringSubmatch(text)
-
-    if len(command) > 0 {
-        doPing()
-        return
-    }
-
-    // Handle the 'promote' command.
-
-    command = regexp.
-            MustCompile("<[^>]+> +promote +([^ ]+) +([^ ]+) +to +(.*)").
-            FindStringSubmatch(text)
-
-    if len(command) > 0 {
-        appVersionCode, err := strconv.ParseInt(command[2], 10, 64)
-
-        if err != nil {
-            postSlackMessage("Sorry, I don't understand that version code.")
-            return
-        }
-
-        storeTrack := command[3]
-
-        if storeTrack != "alpha" && storeTrack != "beta" && storeTrack != "internal" {
-            if !getConfigExpression("SLACK_GOD_USER_ID").MatchString(event.User) {
-                postSlackMessage("Sorry, only gods can do that.")
-                return
-            }
-        }
+    err := rtm.GetFile(url, &content)
 
-        doPromote(command[1], appVersionCode, command[3])
-        return
+    if err != nil {
+        return nil, err
     }
 
-    // Handle the 'rollout' command.
-
-    command = regexp.
-            MustCompile("<[^>]+> +rollout +([^ ]+) +([^ ]+) +to +(.*)%").
-            FindStringSubmatch(text)
-
-    if len(command) > 0 {
-        appVersionCode, err := strconv.ParseInt(command[2], 10, 64)
-
-        if err != nil {
-            postSlackMessage("Sorry, I don't understand that version code.")
-            return
-        }
+    return content.Bytes(), nil
+}
 
-        userPercentage, err := strconv.Atoi(command[3])
+func escapeSlackText(text string) string {
+    text = strings.Replace(text, "&", "&amp;", -1)
+    text = strings.Replace(text, "<", "&lt;", -1)
+    text = strings.Replace(text, ">", "&gt;", -1)
 
-        if err != nil {
-            postSlackMessage("Sorry, I don't understand that user percentage.")
-            return
-        }
+    return text
+}
 
-        if !getConfigExpression("SLACK_GOD_USER_ID").MatchString(event.User) {
-            postSlackMessage("Sorry, only gods can do that.")
-            return
-        }
+func handleSlackMessage(event *slack.MessageEvent) {
+    text := event.Msg.Text
 
-        doRollout(command[1], appVersionCode, userPercentage)
-        return
+    if len(event.User) == 0 {
+        log.Printf("#%v %v", event.Channel, text)
+    } else {
+        log.Printf("#%v %v: %v", event.Channel, event.User, text)
     }
 
-    // Handle the 'show release notes' command.
-
-    command = regexp.
-            MustCompile("<[^>]+> +show +release +notes +for +([^ ]+) +(.+)").
-            FindStringSubmatch(text)
-
-    if len(command) > 0 {
-        appVersionCode, err := strconv.ParseInt(command[2], 10, 64)
-
-        if err != nil {
-            postSlackMessage("Sorry, I don't understand that version code.")
-            return
-        }
-
-        doShowReleaseNotes(command[1], appVersionCode)
+    if event.Channel != getConfig("SLACK_BOT_CHANNEL_ID") {
         return
     }
 
-    // Handle the 'show tracks' command.
-
-    command = regexp.
-            MustCompile("<[^>]+> +show +tracks +for +(.+)").
-            FindStringSubmatch(text)
+    textPrefix := fmt.Sprintf("<@%s>", getConfig("SLACK_BOT_USER_ID"))
 
-    if len(command) > 0 {
-        doShowTracks(command[1])
+    if !strings.HasPrefix(text, textPrefix) {
         return
     }
 
-    doHelp()
+    handleSlackCommand(event.User, text, event.Msg.Files)
 }
 
 func handleSlackMessages() {
@@ -174,9 +73,38 @@ func handleSlackMessages() {
     }
 }
 
+func postSlackFile(fileName string, fileType string, content string) bool {
+    if rtm == nil {
+        log.Printf("%v:\n%v", fileName, content)
+        return true
+    }
+
+    _, err := rtm.UploadFile(slack.FileUploadParameters {
+        Channels: []string {getConfig("SLACK_BOT_CHANNEL_ID")},
+        Content: content,
+        Filename: fileName,
+        Filetype: fileType,
+        Title: fileName,
+    })
+
+    if err != nil {
+        postSlackMessage("Sorry, I can't upload the file: %v", err)
+        return false
+    }
+
+    return true
+}
+
 func postSlackMessage(message string, arguments ...interface{}) {
     messageText := fmt.Sprintf(message, arguments...)
 
+    // Without a connection, e.g. in tests, the messages go to the log.
+
+    if rtm == nil {
+        log.Print(messageText)
+        return
+    }
+
     _, _, err := rtm.PostMessage(
             getConfig("SLACK_BOT_CHANNEL_ID"),
             slack.MsgOptionText(messageText, false))
@@ -185,3 +113,11 @@ func postSlackMessage(message string, arguments ...interface{}) {
         panic(err)
     }
 }
+
+func unescapeSlackText(text string) string {
+    text = strings.Replace(text, "&lt;", "<", -1)
+    text = strings.Replace(text, "&gt;", ">", -1)
+    text = strings.Replace(text, "&amp;", "&", -1)
+
+    return text
+}
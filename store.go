@@ -2,55 +2,268 @@ package main
 
 import (
     "encoding/base64"
+    "fmt"
     "golang.org/x/oauth2/google"
     "golang.org/x/oauth2/jwt"
-    "google.golang.org/api/androidpublisher/v2"
+    "google.golang.org/api/androidpublisher/v3"
+    "strings"
+)
+
+const (
+    storeReleaseStatusCompleted = "completed"
+    storeReleaseStatusDraft = "draft"
+    storeReleaseStatusHalted = "halted"
+    storeReleaseStatusInProgress = "inProgress"
 )
 
 func addVersionCodeToStoreTrack(
-        publisher *androidpublisher.Service,
-        edit *androidpublisher.AppEdit,
+        edit *storeEdit,
+        track *androidpublisher.Track,
+        release *androidpublisher.TrackRelease) bool {
+    for _, versionCode := range release.VersionCodes {
+        postSlackMessage("Adding version code *%v* to track *%v*.", versionCode, track.Track)
+    }
+
+    track.Releases = append(track.Releases, release)
+
+    return edit.updateTrack(track)
+}
+
+func changeReleaseNotes(
+        edit *storeEdit,
         track *androidpublisher.Track,
-        appId string,
         appVersionCode int64,
-        userFraction float64) bool {
-    postSlackMessage("Adding version code *%v* to track *%v*.", appVersionCode, track.Track)
+        releaseNotes []*androidpublisher.LocalizedText) bool {
+    postSlackMessage("Changing release notes for track *%v*.", track.Track)
 
-    track.UserFraction = userFraction
-    track.VersionCodes = append(track.VersionCodes, appVersionCode)
+    release := findStoreTrackRelease(track, appVersionCode)
 
-    _, err := publisher.Edits.Tracks.
-            Update(appId, edit.Id, track.Track, track).
-            Do()
+    if release == nil {
+        postSlackMessage("Sorry, I can't find version code *%v* in track *%v*.", appVersionCode, track.Track)
+        return false
+    }
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't update the track: %v", err)
+    release.ReleaseNotes = releaseNotes
+
+    return edit.updateTrack(track)
+}
+
+func changeReleaseStatus(
+        edit *storeEdit,
+        track *androidpublisher.Track,
+        appVersionCode int64,
+        status string) bool {
+    postSlackMessage("Changing status for track *%v* to *%v*.", track.Track, status)
+
+    release := findStoreTrackRelease(track, appVersionCode)
+
+    if release == nil {
+        postSlackMessage("Sorry, I can't find version code *%v* in track *%v*.", appVersionCode, track.Track)
         return false
     }
 
-    return true
+    release.Status = status
+
+    return edit.updateTrack(track)
 }
 
 func changeUserFraction(
-        publisher *androidpublisher.Service,
-        edit *androidpublisher.AppEdit,
+        edit *storeEdit,
         track *androidpublisher.Track,
-        appId string,
+        appVersionCode int64,
         userFraction float64) bool {
     postSlackMessage("Changing user fraction for track *%v*.", track.Track)
 
-    track.UserFraction = userFraction
+    release := findStoreTrackRelease(track, appVersionCode)
+
+    if release == nil {
+        postSlackMessage("Sorry, I can't find version code *%v* in track *%v*.", appVersionCode, track.Track)
+        return false
+    }
 
-    _, err := publisher.Edits.Tracks.
-            Update(appId, edit.Id, track.Track, track).
-            Do()
+    release.Status, release.UserFraction = getStoreReleaseStatus(userFraction)
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't update the track: %v", err)
+    return edit.updateTrack(track)
+}
+
+// Refuses to change the rollout of a release that isn't being rolled out. A halted rollout was stopped on purpose,
+// so it has to be resumed first, and Play keeps at most one completed release per track, so a completed release
+// can't become staged again.
+func checkStoreReleaseInProgress(
+        appId string,
+        appVersionCode int64,
+        track *androidpublisher.Track,
+        release *androidpublisher.TrackRelease) bool {
+    switch release.Status {
+    case storeReleaseStatusInProgress:
+        return true
+    case storeReleaseStatusHalted:
+        postSlackMessage(
+                "Sorry, version code *%v* in track *%v* is halted. Try `resume %v %v` first.",
+                appVersionCode,
+                track.Track,
+                appId,
+                appVersionCode)
+    default:
+        postSlackMessage(
+                "Sorry, version code *%v* in track *%v* isn't being rolled out, it's *%v*.",
+                appVersionCode,
+                track.Track,
+                release.Status)
+    }
+
+    return false
+}
+
+// Play keeps at most one completed release per track, so the completed release gets superseded.
+func completeStoreRelease(
+        edit *storeEdit,
+        track *androidpublisher.Track,
+        appVersionCode int64) bool {
+    postSlackMessage("Completing the rollout for track *%v*.", track.Track)
+
+    release := findStoreTrackRelease(track, appVersionCode)
+
+    if release == nil {
+        postSlackMessage("Sorry, I can't find version code *%v* in track *%v*.", appVersionCode, track.Track)
         return false
     }
 
-    return true
+    var releases []*androidpublisher.TrackRelease
+
+    for _, candidate := range track.Releases {
+        if candidate != release && candidate.Status == storeReleaseStatusCompleted {
+            postSlackMessage("Dropping the superseded %v from track *%v*.", formatStoreRelease(candidate), track.Track)
+            continue
+        }
+
+        releases = append(releases, candidate)
+    }
+
+    release.Status = storeReleaseStatusCompleted
+    release.UserFraction = 0
+
+    track.Releases = releases
+
+    return edit.updateTrack(track)
+}
+
+func copyStoreTrack(track *androidpublisher.Track) *androidpublisher.Track {
+    result := *track
+    result.Releases = nil
+
+    for _, release := range track.Releases {
+        releaseCopy := *release
+        releaseCopy.ReleaseNotes = append([]*androidpublisher.LocalizedText {}, release.ReleaseNotes...)
+        releaseCopy.VersionCodes = append([]int64 {}, release.VersionCodes...)
+
+        result.Releases = append(result.Releases, &releaseCopy)
+    }
+
+    return &result
+}
+
+func copyStoreTracks(tracks []*androidpublisher.Track) []*androidpublisher.Track {
+    var result []*androidpublisher.Track
+
+    for _, track := range tracks {
+        result = append(result, copyStoreTrack(track))
+    }
+
+    return result
+}
+
+func findStoreRelease(
+        tracks []*androidpublisher.Track,
+        appVersionCode int64) (*androidpublisher.Track, *androidpublisher.TrackRelease) {
+    for _, track := range tracks {
+        release := findStoreTrackRelease(track, appVersionCode)
+
+        if release != nil {
+            return track, release
+        }
+    }
+
+    return nil, nil
+}
+
+func findStoreTrack(tracks []*androidpublisher.Track, storeTrack string) *androidpublisher.Track {
+    for _, candidate := range tracks {
+        if candidate.Track == storeTrack {
+            return candidate
+        }
+    }
+
+    return &androidpublisher.Track {Track: storeTrack}
+}
+
+func findStoreTrackRelease(track *androidpublisher.Track, appVersionCode int64) *androidpublisher.TrackRelease {
+    for _, release := range track.Releases {
+        for _, candidate := range release.VersionCodes {
+            if candidate == appVersionCode {
+                return release
+            }
+        }
+    }
+
+    return nil
+}
+
+func formatStoreRelease(release *androidpublisher.TrackRelease) string {
+    result := fmt.Sprintf("release *%v* with version codes *%v* (%v)", release.Name, release.VersionCodes, release.Status)
+
+    if release.UserFraction > 0 {
+        result += fmt.Sprintf(" at *%v%%*", release.UserFraction * 100)
+    }
+
+    return result
+}
+
+func formatStoreTrack(track *androidpublisher.Track) string {
+    if len(track.Releases) == 0 {
+        return "_nothing_"
+    }
+
+    var releases []string
+
+    for _, release := range track.Releases {
+        releases = append(releases, formatStoreRelease(release))
+    }
+
+    return strings.Join(releases, " and ")
+}
+
+// The promoted release keeps the name and release notes of its current release.
+func getPromotedStoreRelease(
+        tracks []*androidpublisher.Track,
+        appVersionCode int64,
+        userFraction float64) *androidpublisher.TrackRelease {
+    _, release := findStoreRelease(tracks, appVersionCode)
+
+    if release == nil {
+        return newStoreRelease(fmt.Sprint(appVersionCode), appVersionCode, userFraction, nil)
+    }
+
+    result := newStoreRelease(release.Name, appVersionCode, userFraction, release.ReleaseNotes)
+
+    // Split APKs move together.
+
+    result.VersionCodes = append([]int64 {}, release.VersionCodes...)
+
+    return result
+}
+
+func getStoreAppId(app string) string {
+    return fmt.Sprintf("%v.%v", getConfig("ANDROID_APP_ID_PREFIX"), app)
+}
+
+// Play only accepts user fractions strictly between 0 and 1 for staged releases.
+func getStoreReleaseStatus(userFraction float64) (string, float64) {
+    if userFraction > 0 && userFraction < 1 {
+        return storeReleaseStatusInProgress, userFraction
+    }
+
+    return storeReleaseStatusCompleted, 0
 }
 
 func loadStoreCredentials() *jwt.Config {
@@ -73,54 +286,71 @@ func loadStoreCredentials() *jwt.Config {
     return result
 }
 
-func removeAllVersionCodesFromStoreTrack(
-        publisher *androidpublisher.Service,
-        edit *androidpublisher.AppEdit,
-        track *androidpublisher.Track,
-        appId string) bool {
-    for _, versionCode := range track.VersionCodes {
-        postSlackMessage("Removing version code *%v* from track *%v*.", versionCode, track.Track)
+func newStoreRelease(
+        name string,
+        appVersionCode int64,
+        userFraction float64,
+        releaseNotes []*androidpublisher.LocalizedText) *androidpublisher.TrackRelease {
+    release := &androidpublisher.TrackRelease {
+        Name: name,
+        ReleaseNotes: releaseNotes,
+        VersionCodes: []int64 {appVersionCode},
     }
 
-    track.VersionCodes = []int64 {}
+    release.Status, release.UserFraction = getStoreReleaseStatus(userFraction)
 
-    _, err := publisher.Edits.Tracks.
-            Update(appId, edit.Id, track.Track, track).
-            Do()
+    return release
+}
 
-    if err != nil {
-        postSlackMessage("Sorry, I can't update the track: %v", err)
-        return false
+func removeAllVersionCodesFromStoreTrack(
+        edit *storeEdit,
+        track *androidpublisher.Track) bool {
+    for _, release := range track.Releases {
+        for _, versionCode := range release.VersionCodes {
+            postSlackMessage("Removing version code *%v* from track *%v*.", versionCode, track.Track)
+        }
     }
 
-    return true
+    track.Releases = []*androidpublisher.TrackRelease {}
+
+    return edit.updateTrack(track)
 }
 
 func removeVersionCodeFromStoreTracks(
-        publisher *androidpublisher.Service,
-        edit *androidpublisher.AppEdit,
-        tracks []*androidpublisher.Track,
-        appId string,
+        edit *storeEdit,
         appVersionCode int64) bool {
-    for _, track := range tracks {
-        var appVersionCodes []int64
+    for _, track := range edit.tracks {
+        var releases []*androidpublisher.TrackRelease
 
-        for _, candidate := range track.VersionCodes {
-            if candidate == appVersionCode {
-                postSlackMessage("Removing version code *%v* from track *%v*.", candidate, track.Track)
-            } else {
-                appVersionCodes = append(appVersionCodes, candidate)
+        changed := false
+
+        for _, release := range track.Releases {
+            var appVersionCodes []int64
+
+            for _, candidate := range release.VersionCodes {
+                if candidate == appVersionCode {
+                    postSlackMessage("Removing version code *%v* from track *%v*.", candidate, track.Track)
+                    changed = true
+                } else {
+                    appVersionCodes = append(appVersionCodes, candidate)
+                }
+            }
+
+            // Play rejects releases without version codes.
+
+            if len(appVersionCodes) > 0 {
+                release.VersionCodes = appVersionCodes
+                releases = append(releases, release)
             }
         }
 
-        track.VersionCodes = appVersionCodes
+        if !changed {
+            continue
+        }
 
-        _, err := publisher.Edits.Tracks.
-                Update(appId, edit.Id, track.Track, track).
-                Do()
+        track.Releases = releases
 
-        if err != nil {
-            postSlackMessage("Sorry, I can't update the track: %v", err)
+        if !edit.updateTrack(track) {
             return false
         }
     }